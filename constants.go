@@ -22,6 +22,20 @@ const (
 	opBetween      = "$between"
 	opSimilarTo    = "$similarto"
 	opNotSimilarTo = "$nsimilarto"
+	opNor          = "$nor"
+	opRegex        = "$regex"
+	opIRegex       = "$iregex"
+	opNotRegex     = "$nregex"
+	opNotIRegex    = "$niregex"
+	opExists       = "$exists"
+	opStartsWith   = "$startsWith"
+	opEndsWith     = "$endsWith"
+	opContains     = "$contains"
+	opDistinct     = "$isDistinctFrom"
+	opNotDistinct  = "$isNotDistinctFrom"
+	opSome         = "$some"
+	opNone         = "$none"
+	opEvery        = "$every"
 )
 
 // List of various SQL constants
@@ -48,6 +62,8 @@ const (
 	sqlNotSimilarTo   = "NOT SIMILAR TO"
 	sqlIsNull         = "IS NULL"
 	sqlIsNotNull      = "IS NOT NULL"
+	sqlDistinct       = "IS DISTINCT FROM"
+	sqlNotDistinct    = "IS NOT DISTINCT FROM"
 	sqlRegexMatch     = "~"
 	sqlIRegexMatch    = "~*"
 	sqlNotRegexMatch  = "!~"
@@ -63,19 +79,28 @@ const (
 	bRParenthesis byte = ')'
 	bDollar       byte = '$'
 	bQestionMark  byte = '?'
+	bBackslash    byte = '\\'
+	bPercent      byte = '%'
+	bUnderscore   byte = '_'
 )
 
 // for query template
 const (
-	tColumns = "{{COLUMNS}}"
-	tWhere   = "{{WHERE}}"
-	tHaving  = "{{HAVING}}"
-	tGroupBy = "{{GROUPBY}}"
-	tOrderBy = "{{ORDERBY}}"
-	tLimit   = "{{LIMIT}}"
-	tOffset  = "{{OFFSET}}"
-	tSelect  = "SELECT"
-	tWith    = "WITH"
+	tOpen       = "{{"
+	tClose      = "}}"
+	tSlotSep    = ":"
+	tValue      = "_value"
+	tColumns    = "COLUMNS"
+	tWhere      = "WHERE"
+	tHaving     = "HAVING"
+	tExpr       = "EXPR"
+	tGroupBy    = "GROUPBY"
+	tOrderBy    = "ORDERBY"
+	tLimit      = "LIMIT"
+	tOffset     = "OFFSET"
+	tSelect     = "SELECT"
+	tWith       = "WITH"
+	defaultSlot = ""
 )
 
 // operator mapping for expression tree
@@ -100,4 +125,15 @@ var opToSQL = map[string]string{
 	opBetween:      sqlBetween,
 	opSimilarTo:    sqlSimilarTo,
 	opNotSimilarTo: sqlNotSimilarTo,
+	opNor:          sqlOr,
+	opRegex:        sqlRegexMatch,
+	opIRegex:       sqlIRegexMatch,
+	opNotRegex:     sqlNotRegexMatch,
+	opNotIRegex:    sqlNotIRegexMatch,
+	opExists:       sqlIsNotNull,
+	opStartsWith:   sqlLike,
+	opEndsWith:     sqlLike,
+	opContains:     sqlLike,
+	opDistinct:     sqlDistinct,
+	opNotDistinct:  sqlNotDistinct,
 }
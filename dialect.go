@@ -0,0 +1,211 @@
+package squery
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect describes database specific part of the generated SQL
+type Dialect interface {
+	// Name of the dialect, e.g. postgres
+	Name() string
+
+	// Placeholder create new placeholder generator
+	Placeholder() Placeholder
+
+	// WriteList writes list of n placeholders, e.g. ($1,$2,$3).
+	// Empty list must still produce valid SQL.
+	WriteList(sb StringBuilder, ph Placeholder, n int)
+
+	// WriteLimit writes LIMIT clause
+	WriteLimit(sb StringBuilder, limit int64)
+
+	// WriteOffset writes OFFSET clause, hasLimit tells whether LIMIT has been written.
+	WriteOffset(sb StringBuilder, offset int64, hasLimit bool)
+
+	// JSONPath return expression extracting property at path from JSON column,
+	// casted to dataType (one of JSONText, JSONNumber, JSONBoolean or JSONTimestamp).
+	JSONPath(column string, path []string, dataType string) string
+
+	// WriteDistinctFrom writes NULL-safe comparison of field and value,
+	// i.e. IS DISTINCT FROM or IS NOT DISTINCT FROM when distinct is false.
+	WriteDistinctFrom(sb StringBuilder, field, value string, distinct bool)
+
+	// WriteLikeEscape writes ESCAPE clause declaring backslash as escape character of LIKE pattern
+	WriteLikeEscape(sb StringBuilder)
+
+	// QuoteIdent quotes identifier, qualified name is separated by dot, e.g. "t"."name"
+	QuoteIdent(name string) string
+}
+
+// Supported dialects
+var (
+	Postgres Dialect = psqlDialect{}
+	MySQL    Dialect = mysqlDialect{}
+	SQLite   Dialect = sqliteDialect{}
+)
+
+// postgresql dialect, i.e. $1, $2 placeholder
+type psqlDialect struct{}
+
+// mysql dialect, i.e. ? placeholder, OFFSET requires LIMIT
+type mysqlDialect struct {
+	psqlDialect
+}
+
+// sqlite dialect, i.e. ? placeholder, OFFSET requires LIMIT
+type sqliteDialect struct {
+	psqlDialect
+}
+
+func (psqlDialect) Name() string {
+	return "postgres"
+}
+
+func (d psqlDialect) Placeholder() Placeholder {
+	return &dialectPlaceholder{Placeholder: NewPsqlPlaceholder(), dialect: d}
+}
+
+func (psqlDialect) WriteList(sb StringBuilder, ph Placeholder, n int) {
+	sb.WriteByte(bLParenthesis)
+	if n == 0 {
+		// empty list of IN/NOT IN is replaced by the template query,
+		// other use of empty list, e.g. ANY(...), is written as valid SQL
+		sb.WriteString("NULL")
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteByte(bComma)
+		}
+		sb.WriteString(ph.Next())
+	}
+	sb.WriteByte(bRParenthesis)
+}
+
+func (psqlDialect) WriteLimit(sb StringBuilder, limit int64) {
+	sb.WriteString(" LIMIT ")
+	sb.WriteString(strconv.FormatInt(limit, 10))
+	sb.WriteByte(bSpace)
+}
+
+func (psqlDialect) WriteOffset(sb StringBuilder, offset int64, hasLimit bool) {
+	sb.WriteString(" OFFSET ")
+	sb.WriteString(strconv.FormatInt(offset, 10))
+	sb.WriteByte(bSpace)
+}
+
+func (psqlDialect) WriteLikeEscape(sb StringBuilder) {
+	sb.WriteString(` ESCAPE '\'`)
+}
+
+func (psqlDialect) QuoteIdent(name string) string {
+	return quoteIdent(name, '"')
+}
+
+func (psqlDialect) WriteDistinctFrom(sb StringBuilder, field, value string, distinct bool) {
+	sb.WriteString(field)
+	sb.WriteByte(bSpace)
+	if distinct {
+		sb.WriteString(sqlDistinct)
+	} else {
+		sb.WriteString(sqlNotDistinct)
+	}
+	sb.WriteByte(bSpace)
+	sb.WriteString(value)
+}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (d mysqlDialect) Placeholder() Placeholder {
+	return &dialectPlaceholder{Placeholder: NewQmPlaceholder(), dialect: d}
+}
+
+// WriteLikeEscape writes backslash escaped in string literal
+func (mysqlDialect) WriteLikeEscape(sb StringBuilder) {
+	sb.WriteString(` ESCAPE '\\'`)
+}
+
+// QuoteIdent quotes identifier with backtick
+func (mysqlDialect) QuoteIdent(name string) string {
+	return quoteIdent(name, '`')
+}
+
+func (d mysqlDialect) WriteOffset(sb StringBuilder, offset int64, hasLimit bool) {
+	if !hasLimit {
+		// maximum number of rows, see MySQL documentation of LIMIT
+		sb.WriteString(" LIMIT 18446744073709551615")
+	}
+	d.psqlDialect.WriteOffset(sb, offset, hasLimit)
+}
+
+// WriteDistinctFrom uses NULL-safe equal operator <=>
+func (mysqlDialect) WriteDistinctFrom(sb StringBuilder, field, value string, distinct bool) {
+	if distinct {
+		sb.WriteString(sqlNot)
+		sb.WriteByte(bSpace)
+	}
+	sb.WriteByte(bLParenthesis)
+	sb.WriteString(field)
+	sb.WriteString(" <=> ")
+	sb.WriteString(value)
+	sb.WriteByte(bRParenthesis)
+}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (d sqliteDialect) Placeholder() Placeholder {
+	return &dialectPlaceholder{Placeholder: NewQmPlaceholder(), dialect: d}
+}
+
+// WriteDistinctFrom uses IS and IS NOT which are NULL-safe in sqlite
+func (sqliteDialect) WriteDistinctFrom(sb StringBuilder, field, value string, distinct bool) {
+	sb.WriteString(field)
+	sb.WriteByte(bSpace)
+	if distinct {
+		sb.WriteString(sqlIsNot)
+	} else {
+		sb.WriteString(sqlIs)
+	}
+	sb.WriteByte(bSpace)
+	sb.WriteString(value)
+}
+
+func (d sqliteDialect) WriteOffset(sb StringBuilder, offset int64, hasLimit bool) {
+	if !hasLimit {
+		// negative LIMIT means no upper bound
+		sb.WriteString(" LIMIT -1")
+	}
+	d.psqlDialect.WriteOffset(sb, offset, hasLimit)
+}
+
+// dialectPlaceholder is placeholder created by dialect, so that
+// field F written using the placeholder is quoted by the dialect
+type dialectPlaceholder struct {
+	Placeholder
+	dialect Dialect
+}
+
+// quoteIdent quotes every part of dot separated name, quote inside the name is doubled
+func quoteIdent(name string, quote byte) string {
+	q := string(quote)
+	items := strings.Split(name, ".")
+	for i, item := range items {
+		items[i] = q + strings.ReplaceAll(item, q, q+q) + q
+	}
+	return strings.Join(items, ".")
+}
+
+// writeTerm writes term, field F is quoted by dialect of the placeholder
+func writeTerm(sb StringBuilder, ph Placeholder, term Stringer) {
+	if f, ok := term.(F); ok {
+		if dp, ok := ph.(*dialectPlaceholder); ok {
+			sb.WriteString(dp.dialect.QuoteIdent(string(f)))
+			return
+		}
+	}
+	sb.WriteString(term.String())
+}
@@ -0,0 +1,90 @@
+package squery
+
+import (
+	"errors"
+	"strings"
+)
+
+// Error codes of FilterError
+const (
+	ErrCodeSyntax             = "syntax_error"
+	ErrCodeInvalidValue       = "invalid_value"
+	ErrCodeUnknownField       = "unknown_field"
+	ErrCodeOperatorNotAllowed = "operator_not_allowed"
+	ErrCodeUnknownOperator    = "unknown_operator"
+	ErrCodeLimitExceeded      = "limit_exceeded"
+)
+
+// FilterError describes invalid part of JSON filter
+type FilterError struct {
+	Path    string `json:"path"`    // JSON path of the term, e.g. $.$or[2].age.$between
+	Term    string `json:"term"`    // field or operator of the invalid value
+	Code    string `json:"code"`    // machine readable code, e.g. invalid_value
+	Message string `json:"message"` // human readable message
+	Err     error  `json:"-"`       // underlying error, if any
+}
+
+// Error interface
+func (e *FilterError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Unwrap return underlying error
+func (e *FilterError) Unwrap() error {
+	return e.Err
+}
+
+// FilterErrors is every error found while parsing the filter, in order of appearance
+type FilterErrors []*FilterError
+
+// Error interface
+func (es FilterErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// As finds the first error that matches target, so that errors.As can be used with the list
+func (es FilterErrors) As(target interface{}) bool {
+	for _, e := range es {
+		if errors.As(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Is reports whether any error matches target
+func (es FilterErrors) Is(target error) bool {
+	for _, e := range es {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// newFilterError create error of the node
+func newFilterError(nd *treeNode, code, msg string, err error) *FilterError {
+	return &FilterError{
+		Path:    nd.path,
+		Term:    nd.Term,
+		Code:    code,
+		Message: msg,
+		Err:     err,
+	}
+}
+
+// wrapFilterError wraps err of the node, nil is returned if err is nil
+func wrapFilterError(nd *treeNode, code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var fe *FilterError
+	if errors.As(err, &fe) {
+		return err
+	}
+	return newFilterError(nd, code, err.Error(), err)
+}
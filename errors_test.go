@@ -0,0 +1,87 @@
+package squery_test
+
+import (
+	"errors"
+	"testing"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterErrors(t *testing.T) {
+	filter := `{"$or": [{"name": "A"}, {"age": 1}, {"age": {"$between": [1]}}], "unknown": 1, "id": "x"}`
+	_, err := qy.NewTree(nil).Schema(testSchema()).Parse([]byte(filter))
+
+	var errs qy.FilterErrors
+	if assert.True(t, errors.As(err, &errs)) {
+		assert.Len(t, errs, 3)
+		assert.Equal(t, &qy.FilterError{
+			Path:    "$.$or[2].age.$between",
+			Term:    "$between",
+			Code:    qy.ErrCodeInvalidValue,
+			Message: "$between operator needs array args with 2 values",
+		}, errs[0])
+		assert.Equal(t, "$.unknown", errs[1].Path)
+		assert.Equal(t, qy.ErrCodeUnknownField, errs[1].Code)
+		assert.Equal(t, "$.id", errs[2].Path)
+		assert.Equal(t, "id", errs[2].Term)
+		assert.Equal(t, qy.ErrCodeInvalidValue, errs[2].Code)
+	}
+
+	// syntax error stops the parsing
+	_, err = qy.NewTree(nil).Parse([]byte(`{"$or": [{"name": "A"}, 1]}`))
+	var fe *qy.FilterError
+	if assert.True(t, errors.As(err, &fe)) {
+		assert.Equal(t, "$.$or[1]", fe.Path)
+		assert.Equal(t, qy.ErrCodeSyntax, fe.Code)
+	}
+
+	// limit error is wrapped
+	_, err = qy.NewTree(nil).Limits(qy.FilterLimits{MaxNodes: 1}).Parse([]byte(`{"a": 1, "b": 2}`))
+	var limitErr *qy.LimitError
+	assert.True(t, errors.As(err, &limitErr))
+	if assert.True(t, errors.As(err, &fe)) {
+		assert.Equal(t, "$.b", fe.Path)
+		assert.Equal(t, qy.ErrCodeLimitExceeded, fe.Code)
+	}
+}
+
+func TestFilterErrorsOperators(t *testing.T) {
+	near := func(field string, value interface{}, ph qy.Placeholder) (string, []interface{}, error) {
+		return field + " <-> " + ph.Next(), []interface{}{value}, nil
+	}
+	tests := []struct {
+		filter string
+		path   string
+		code   string
+	}{
+		{`{"age": {"$unknown": 5}}`, "$.age.$unknown", qy.ErrCodeUnknownOperator},
+		{`{"$or": [{"age": {"$gt": 1}}, {"age": {"$gtx": 1}}]}`, "$.$or[1].age.$gtx", qy.ErrCodeUnknownOperator},
+		{`{"age": {"name": 5}}`, "$.age.name", qy.ErrCodeSyntax},
+		{`{"age": {"$not": {"name": 5}}}`, "$.age.$not.name", qy.ErrCodeSyntax},
+		{`{"$gt": 5}`, "$.$gt", qy.ErrCodeSyntax},
+		{`{"$near": 5}`, "$.$near", qy.ErrCodeSyntax},
+		{`{"$and": [{"$near": 5}]}`, "$.$and[0].$near", qy.ErrCodeSyntax},
+		{`{"age": {"$gt": {"$lt": 5}}}`, "$.age.$gt", qy.ErrCodeInvalidValue},
+		{`{"name": {"$exists": "yes"}}`, "$.name.$exists", qy.ErrCodeInvalidValue},
+		{`{"name": {"$exists": null}}`, "$.name.$exists", qy.ErrCodeInvalidValue},
+		{`{"name": {"$contains": 10}}`, "$.name.$contains", qy.ErrCodeInvalidValue},
+		{`{"name": {"$startsWith": true}}`, "$.name.$startsWith", qy.ErrCodeInvalidValue},
+		{`{"name": {"$endsWith": null}}`, "$.name.$endsWith", qy.ErrCodeInvalidValue},
+	}
+	for _, test := range tests {
+		_, err := qy.NewTree(nil).RegisterOperator("$near", near).Parse([]byte(test.filter))
+		var errs qy.FilterErrors
+		if assert.True(t, errors.As(err, &errs), test.filter) && assert.Len(t, errs, 1, test.filter) {
+			assert.Equal(t, test.path, errs[0].Path, test.filter)
+			assert.Equal(t, test.code, errs[0].Code, test.filter)
+		}
+	}
+
+	// operator errors are reported without errors of the schema
+	_, err := qy.NewTree(nil).Schema(testSchema()).Parse([]byte(`{"age": {"$unknown": 5}, "id": "x"}`))
+	var errs qy.FilterErrors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs, 1) {
+		assert.Equal(t, "$.age.$unknown", errs[0].Path)
+	}
+}
@@ -113,7 +113,7 @@ func (e postExpr) Build(sb StringBuilder, ph Placeholder) ([]interface{}, error)
 		return nil, nil
 	}
 	sb.WriteByte(bLParenthesis)
-	sb.WriteString(e.term.String())
+	writeTerm(sb, ph, e.term)
 	sb.WriteByte(bSpace)
 	sb.WriteString(e.op)
 	sb.WriteByte(bRParenthesis)
@@ -144,7 +144,7 @@ func (e binaryExpr) Build(sb StringBuilder, ph Placeholder) ([]interface{}, erro
 		return nil, nil
 	}
 	sb.WriteByte(bLParenthesis)
-	sb.WriteString(e.term.String())
+	writeTerm(sb, ph, e.term)
 	sb.WriteByte(bSpace)
 	sb.WriteString(e.op)
 	sb.WriteByte(bSpace)
@@ -165,7 +165,7 @@ func (e ternaryExpr) Build(sb StringBuilder, ph Placeholder) ([]interface{}, err
 		return nil, nil
 	}
 	sb.WriteByte(bLParenthesis)
-	sb.WriteString(e.term.String())
+	writeTerm(sb, ph, e.term)
 	sb.WriteByte(bSpace)
 	sb.WriteString(e.op1)
 	sb.WriteByte(bSpace)
@@ -188,7 +188,7 @@ func (e arrExpr) Build(sb StringBuilder, ph Placeholder) ([]interface{}, error)
 		return nil, nil
 	}
 	sb.WriteByte(bLParenthesis)
-	sb.WriteString(e.term.String())
+	writeTerm(sb, ph, e.term)
 	sb.WriteByte(bSpace)
 	sb.WriteString(e.op)
 	sb.WriteByte(bSpace)
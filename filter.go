@@ -67,8 +67,9 @@ type Sort struct {
 
 // Pagination of the result
 type Pagination struct {
-	Page        int64   `json:"page"`    // starts from 0
-	PerPage     int64   `json:"perPage"` // number of record in one page
+	Page        int64   `json:"page"`           // starts from 0
+	PerPage     int64   `json:"perPage"`        // number of record in one page
+	Skip        int64   `json:"skip,omitempty"` // number of record skipped before the page, e.g. OData $skip
 	NextPageKey *string `json:"nextPageKey"`
 	offset      int64
 }
@@ -108,6 +109,9 @@ type TemplateListSearchArg struct {
 	CountTemplate  string               `json:"-"`
 	FieldsMap      map[string]string    `json:"-"`
 	SelectColsMap  map[string]*DbColumn `json:"-"`
+	JSONColumns    JSONColumns          `json:"-"`
+	Dialect        Dialect              `json:"-"`
+	TermMapper     FnMapTerm            `json:"-"` // maps virtual fields, used before FieldsMap
 }
 
 // DataList for storing many/list query result
@@ -122,15 +126,21 @@ type DataList struct {
 type queryTermExp struct {
 	queryTerm    *QueryTerm
 	fullTextCols []string
-	fm           FnMapField
+	tm           FnMapTerm
 }
 
 // NewQueryTermExpression convert query term to expression
 func NewQueryTermExpression(q *QueryTerm, fulltextCols []string, fm FnMapField) Expression {
+	return NewQueryTermExpressionWithMapper(q, fulltextCols, TermMapper(fm))
+}
+
+// NewQueryTermExpressionWithMapper convert query term to expression, columns are mapped
+// using term mapper, so that virtual field with bound arguments can be searched.
+func NewQueryTermExpressionWithMapper(q *QueryTerm, fulltextCols []string, tm FnMapTerm) Expression {
 	return &queryTermExp{
 		queryTerm:    q,
 		fullTextCols: fulltextCols,
-		fm:           fm,
+		tm:           tm,
 	}
 }
 
@@ -164,13 +174,17 @@ func (q *queryTermExp) Build(sb StringBuilder, ph Placeholder) ([]interface{}, e
 	numItem := 0
 	args := []interface{}{}
 	for _, col := range columns {
-		if field, err := q.fm(col); err == nil {
+		if field, err := q.tm(col); err == nil && field != nil {
 			// construct clause, e.g. (name SIMILAR TO ?) OR (tile LIKE ?)
 			if numItem > 0 {
 				sb.WriteString(" OR ")
 			}
 			sb.WriteByte(bLParenthesis)
-			sb.WriteString(field)
+			varg, err := field.Build(sb, ph)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, varg...)
 			sb.WriteByte(bSpace)
 			sb.WriteString(matcher)
 			sb.WriteByte(bSpace)
@@ -217,19 +231,65 @@ func (l *ListSearchArg) IsZero() bool {
 		l.Query == nil
 }
 
-// FieldMapper map between JSON field to valid DB fields or snake_cased version
+// FieldMapper map between JSON field to valid DB fields or snake_cased version.
+// Field in declared JSON column, e.g. data.address.city, is mapped to property extraction.
 func (t *TemplateListSearchArg) FieldMapper(jsField string) (string, error) {
 	field, ok := t.FieldsMap[jsField]
 	if !ok {
+		if expr, isJSON, err := t.JSONColumns.Expr(t.Dialect, jsField, ""); isJSON {
+			return expr, err
+		}
 		return strcase.ToSnake(jsField), nil
 	}
 	return field, nil
 }
 
-// SelectColumnsMapper map between JSON field to valid DB columns or snake_cased version
+// MapTerm maps JSON field into SQL term using TermMapper, or FieldMapper
+// if the field is not virtual field.
+func (t *TemplateListSearchArg) MapTerm(jsField string) (Builder, error) {
+	if t.TermMapper != nil {
+		term, err := t.TermMapper(jsField)
+		if err != nil || term != nil {
+			return term, err
+		}
+	}
+	return TermMapper(t.FieldMapper)(jsField)
+}
+
+// FilterTree parse Filter into expression tree using TermMapper, FieldMapper and JSONColumns
+func (t *TemplateListSearchArg) FilterTree() (*Tree, error) {
+	tree := NewTree(t.FieldMapper).TermMapper(t.TermMapper).JSONColumns(t.JSONColumns)
+	if t.Dialect != nil {
+		tree.Dialect(t.Dialect)
+	}
+	return tree.Parse(t.Filter)
+}
+
+// OrderBy return ORDER BY clause of Sorts, virtual fields are mapped using TermMapper
+func (t *TemplateListSearchArg) OrderBy() BoundTerms {
+	return t.Sorts.OrderBy(t.MapTerm)
+}
+
+// SelectColumnsMapper map between JSON field to valid DB columns or snake_cased version.
+// Virtual field is selected as BoundTerm.
 func (t *TemplateListSearchArg) SelectColumnsMapper(jsField string) (Stringer, error) {
+	if t.TermMapper != nil {
+		term, err := t.TermMapper(jsField)
+		if err != nil {
+			return nil, err
+		}
+		if term != nil {
+			return &BoundTerm{Term: term, Suffix: " AS " + strconv.Quote(jsField)}, nil
+		}
+	}
 	col, ok := t.SelectColsMap[jsField]
 	if !ok {
+		if expr, isJSON, err := t.JSONColumns.Expr(t.Dialect, jsField, ""); isJSON {
+			if err != nil {
+				return nil, err
+			}
+			return S(expr + " AS " + strconv.Quote(jsField)), nil
+		}
 		col = &DbColumn{
 			ColumnExpr: strcase.ToSnake(jsField),
 			Label:      strcase.ToScreamingDelimited(jsField, ' ', "", true),
@@ -359,6 +419,20 @@ func (sc SortConditions) Clause(jsToField map[string]string) string {
 	return sb.String()
 }
 
+// OrderBy return ORDER BY clause of the sort conditions, e.g. age_at($1, birth_date) DESC,name ASC.
+// Fields which can not be mapped are skipped.
+func (sc SortConditions) OrderBy(tm FnMapTerm) BoundTerms {
+	terms := BoundTerms{}
+	for _, sfields := range sc {
+		for _, field := range sfields.Fields {
+			if term, err := tm(field); err == nil && term != nil {
+				terms = append(terms, &BoundTerm{Term: term, Suffix: " " + sfields.OrderString()})
+			}
+		}
+	}
+	return terms
+}
+
 func (p *Pagination) Calculate(maxPerPage int64) {
 	// get valid per-page count
 	perPage := p.PerPage
@@ -380,7 +454,7 @@ func (p *Pagination) Calculate(maxPerPage int64) {
 	if p.Page <= 0 {
 		p.Page = 1
 	}
-	p.offset = (p.Page - 1) * p.PerPage
+	p.offset = (p.Page-1)*p.PerPage + p.Skip
 }
 
 // Offset calculate sql offset (psql)
@@ -0,0 +1,248 @@
+package squery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// ErrRawFilter is returned when raw SQL expression, i.e. Raw or R, is serialized to JSON filter
+var ErrRawFilter = errors.New("raw SQL expression can not be serialized to JSON filter")
+
+// filterEntry is single term of JSON filter object
+type filterEntry struct {
+	key   string
+	value interface{}
+}
+
+// filterObject is JSON filter object which keeps order of the terms
+type filterObject []filterEntry
+
+// MarshalJSON writes the terms in order
+func (fo filterObject) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte(leftBrace)
+	for i, entry := range fo {
+		if i > 0 {
+			buf.WriteByte(bComma)
+		}
+		key, err := json.Marshal(entry.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(entry.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON serializes the tree back to JSON filter, so that Tree -> JSON -> Tree
+// produces the same SQL. Values are written after conversion by the schema.
+func (t *Tree) MarshalJSON() ([]byte, error) {
+	if t.IsEmpty() {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(t.root.filterValue())
+}
+
+// filterValue return JSON value of the node
+func (fn *treeNode) filterValue() interface{} {
+	if fn.ValueType != tOperator || fn.custom {
+		return fn.Value
+	}
+	if fn.Value == opOr {
+		// array of objects, i.e. OR operation
+		items := make([]filterObject, len(fn.Children))
+		for i, child := range fn.Children {
+			items[i] = filterObject{{key: child.Term, value: child.filterValue()}}
+		}
+		return items
+	}
+	obj := make(filterObject, len(fn.Children))
+	for i, child := range fn.Children {
+		obj[i] = filterEntry{key: child.Term, value: child.filterValue()}
+	}
+	return obj
+}
+
+// MarshalFilter serializes expression into JSON filter accepted by NewExpressionTree.
+// Tree, Expressions and expressions created by ExpressionBuilder (except Raw) are supported.
+// ErrRawFilter is returned for raw SQL expression.
+func MarshalFilter(b Builder) (json.RawMessage, error) {
+	if b == nil {
+		return json.RawMessage("{}"), nil
+	}
+	if t, ok := b.(*Tree); ok {
+		return t.MarshalJSON()
+	}
+	if e, ok := b.(Expression); ok && e.IsEmpty() {
+		return json.RawMessage("{}"), nil
+	}
+	obj, err := exprFilter(b)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(obj)
+}
+
+// exprFilter converts expression into JSON filter object
+func exprFilter(b Builder) (filterObject, error) {
+	switch e := b.(type) {
+	case *chainableExpression:
+		if e.expr == nil {
+			return filterObject{}, nil
+		}
+		return exprFilter(e.expr)
+	case *Tree:
+		if e.IsEmpty() {
+			return filterObject{}, nil
+		}
+		if obj, ok := e.root.filterValue().(filterObject); ok {
+			return obj, nil
+		}
+		return filterObject{{key: opOr, value: e.root.filterValue()}}, nil
+	case postExpr:
+		field, err := termFilterField(e.term)
+		if err != nil {
+			return nil, err
+		}
+		if e.op == sqlIsNull {
+			return filterObject{{key: field, value: nil}}, nil
+		}
+		return filterObject{{key: field, value: filterObject{{key: opNeq, value: nil}}}}, nil
+	case notExpr:
+		inner, err := exprFilter(e.expr)
+		if err != nil {
+			return nil, err
+		}
+		return filterObject{{key: opNot, value: inner}}, nil
+	case binaryExpr:
+		op, ok := sqlToFilterOp[e.op]
+		if !ok {
+			return nil, errors.New("operator " + e.op + " can not be serialized to JSON filter")
+		}
+		if e.arg == nil {
+			return nil, errors.New("NULL argument of " + e.op + " can not be serialized to JSON filter")
+		}
+		return fieldFilter(e.term, op, e.arg)
+	case ternaryExpr:
+		return fieldFilter(e.term, opBetween, []interface{}{e.arg1, e.arg2})
+	case arrExpr:
+		op := opIn
+		if e.op == sqlNotIn {
+			op = opNotIn
+		}
+		return fieldFilter(e.term, op, e.args)
+	case arrArgExpr:
+		return listFilter(e)
+	case rawExpr, R:
+		return nil, ErrRawFilter
+	}
+	return nil, errors.New("expression can not be serialized to JSON filter")
+}
+
+// listFilter converts AND/OR expressions
+func listFilter(e arrArgExpr) (filterObject, error) {
+	items := []filterObject{}
+	for _, expr := range e.exprList {
+		if expr == nil || expr.IsEmpty() {
+			continue
+		}
+		obj, err := exprFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, obj)
+	}
+	switch {
+	case len(items) == 0:
+		return filterObject{}, nil
+	case len(items) == 1:
+		return items[0], nil
+	case e.op == sqlOr:
+		return orFilter(items), nil
+	}
+	return andFilter(items), nil
+}
+
+// orFilter joins filter objects with $or. Terms of the objects in $or array are joined
+// with OR, so object having several terms is wrapped with $and.
+func orFilter(items []filterObject) filterObject {
+	if len(items) == 1 {
+		return items[0]
+	}
+	list := make([]filterObject, len(items))
+	for i, obj := range items {
+		list[i] = obj
+		if len(obj) > 1 {
+			list[i] = filterObject{{key: opAnd, value: obj}}
+		}
+	}
+	return filterObject{{key: opOr, value: list}}
+}
+
+// andFilter merges filter objects into single object if the keys are unique,
+// otherwise the objects are joined with $and
+func andFilter(items []filterObject) filterObject {
+	if len(items) == 1 {
+		return items[0]
+	}
+	merged := filterObject{}
+	keys := make(map[string]bool)
+	for _, obj := range items {
+		for _, entry := range obj {
+			if keys[entry.key] {
+				return filterObject{{key: opAnd, value: items}}
+			}
+			keys[entry.key] = true
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
+
+// fieldFilter return filter object of single operator applied to field
+func fieldFilter(term Term, op string, value interface{}) (filterObject, error) {
+	field, err := termFilterField(term)
+	if err != nil {
+		return nil, err
+	}
+	return filterObject{{key: field, value: filterObject{{key: op, value: value}}}}, nil
+}
+
+// termFilterField return field name of the term
+func termFilterField(term Term) (string, error) {
+	switch t := term.(type) {
+	case R:
+		return "", ErrRawFilter
+	case F:
+		return string(t), nil
+	case M:
+		return string(t), nil
+	case S:
+		return string(t), nil
+	}
+	return term.String(), nil
+}
+
+// sqlToFilterOp maps SQL operator of ExpressionBuilder into filter operator
+var sqlToFilterOp = map[string]string{
+	sqlEq:           opEq,
+	sqlNeq:          opNeq,
+	sqlGt:           opGt,
+	sqlGte:          opGte,
+	sqlLt:           opLt,
+	sqlLte:          opLte,
+	sqlLike:         opLike,
+	sqlNotLike:      opNotLike,
+	sqlILike:        opILike,
+	sqlNotILike:     opNotILike,
+	sqlSimilarTo:    opSimilarTo,
+	sqlNotSimilarTo: opNotSimilarTo,
+}
@@ -0,0 +1,75 @@
+package squery_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeMarshalJSON(t *testing.T) {
+	filters := []string{
+		`{"status":"A","$or":[{"qty":{"$lt":30}},{"item":"/^p/"}],"name":null,"locked":false}`,
+		`{"age":{"$gt":18,"$lt":65},"tags":{"$in":["a",null]},"score":{"$between":[1,2.5]}}`,
+		`[{"a":1},{"b":{"$neq":null}}]`,
+		`{"$not":{"name":{"$like":"a%"}},"empty":{"$exists":true}}`,
+	}
+	for _, filter := range filters {
+		tree, err := qy.NewTree(nil).Parse([]byte(filter))
+		if !assert.NoError(t, err, filter) {
+			continue
+		}
+		data, err := json.Marshal(tree)
+		assert.NoError(t, err, filter)
+		assert.Equal(t, filter, string(data))
+
+		// Tree -> JSON -> Tree produces the same SQL
+		clause, args, err := buildFilter(filter)
+		assert.NoError(t, err, filter)
+		clause2, args2, err := buildFilter(string(data))
+		assert.NoError(t, err, filter)
+		assert.Equal(t, clause, clause2, filter)
+		assert.Equal(t, args, args2, filter)
+	}
+}
+
+func TestMarshalFilter(t *testing.T) {
+	e := qy.Expr
+	tests := []struct {
+		expr qy.Builder
+		json string
+	}{
+		{e.Eq(qy.F("name"), "putu"), `{"name":{"$eq":"putu"}}`},
+		{e.And(e.Gt(qy.S("age"), 18), e.Null(qy.F("deleted_at")), e.In(qy.S("id"), 1, 2)),
+			`{"age":{"$gt":18},"deleted_at":null,"id":{"$in":[1,2]}}`},
+		{e.And(e.Gt(qy.S("age"), 18), e.Lt(qy.S("age"), 65)),
+			`{"$and":[{"age":{"$gt":18}},{"age":{"$lt":65}}]}`},
+		{qy.NewExpressions().And(e.Between(qy.F("data.score"), 1, 5)).Or(e.Not(e.NotNull(qy.S("x")))),
+			`{"$or":[{"data.score":{"$between":[1,5]}},{"$not":{"x":{"$neq":null}}}]}`},
+		{e.Or(e.And(e.Eq(qy.S("a"), 1), e.Eq(qy.S("b"), 2)), e.Eq(qy.S("c"), 3)),
+			`{"$or":[{"$and":{"a":{"$eq":1},"b":{"$eq":2}}},{"c":{"$eq":3}}]}`},
+		{qy.NewExpressions(), `{}`},
+	}
+	for _, test := range tests {
+		data, err := qy.MarshalFilter(test.expr)
+		if !assert.NoError(t, err, test.json) {
+			continue
+		}
+		assert.Equal(t, test.json, string(data))
+
+		// JSON is accepted by the tree
+		tree, err := qy.NewTree(nil).Parse(data)
+		if assert.NoError(t, err, test.json) {
+			_, err = tree.Build(&strings.Builder{}, qy.NewPsqlPlaceholder())
+			assert.NoError(t, err, test.json)
+		}
+	}
+
+	_, err := qy.MarshalFilter(e.And(e.Eq(qy.S("a"), 1), e.Raw("b = ?", 2)))
+	assert.True(t, errors.Is(err, qy.ErrRawFilter))
+	_, err = qy.MarshalFilter(e.Eq(qy.R("lower(a)"), "x"))
+	assert.True(t, errors.Is(err, qy.ErrRawFilter))
+}
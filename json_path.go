@@ -0,0 +1,168 @@
+package squery
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// JSON data types used to cast value extracted from JSON document
+const (
+	JSONText      = "text"
+	JSONNumber    = "number"
+	JSONBoolean   = "boolean"
+	JSONTimestamp = "timestamp"
+)
+
+// JSONColumn declares JSON/JSONB column whose nested properties can be filtered,
+// e.g. filter field `data.address.city` refers to property `address.city` of column `data`.
+type JSONColumn struct {
+	Column     string               // SQL expression of the column
+	Properties map[string]*Property // optional metadata keyed by property path, DataType is used for casting
+}
+
+// JSONColumns maps filter field prefix to JSON column, e.g. "data" -> data column
+type JSONColumns map[string]*JSONColumn
+
+var reJSONKey = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*|[0-9]+)$`)
+
+// Resolve splits field into JSON column and property path.
+// It returns false if the field does not refer to declared JSON column.
+func (jc JSONColumns) Resolve(field string) (*JSONColumn, []string, bool, error) {
+	idx := strings.IndexByte(field, '.')
+	if idx <= 0 {
+		return nil, nil, false, nil
+	}
+	col, ok := jc[field[:idx]]
+	if !ok {
+		return nil, nil, false, nil
+	}
+	path := strings.Split(field[idx+1:], ".")
+	for _, key := range path {
+		if !reJSONKey.MatchString(key) {
+			return nil, nil, true, errors.New("invalid JSON path in field " + field)
+		}
+	}
+	return col, path, true, nil
+}
+
+// validateJSONFields checks that path of every JSON field of the node is valid
+func validateJSONFields(nd *treeNode, jc JSONColumns) FilterErrors {
+	var errs FilterErrors
+	switch {
+	case nd.isRoot || nd.isLogical():
+		for _, child := range nd.Children {
+			errs = append(errs, validateJSONFields(child, jc)...)
+		}
+	case !nd.isOperator() && !nd.hasRelationOperators():
+		if _, _, _, err := jc.Resolve(nd.Term); err != nil {
+			errs = append(errs, newFilterError(nd, ErrCodeUnknownField, err.Error(), err))
+		}
+	}
+	return errs
+}
+
+// DataType return declared data type of property path, or empty string if not declared
+func (c *JSONColumn) DataType(path []string) string {
+	prop, ok := c.Properties[strings.Join(path, ".")]
+	if !ok || prop == nil || prop.DataType == nil {
+		return ""
+	}
+	return jsonDataType(*prop.DataType)
+}
+
+// Expr return SQL expression of the JSON field. If dataType is empty, declared data type
+// of the property (or JSONText) is used. Second return value is false if field is not JSON field.
+func (jc JSONColumns) Expr(d Dialect, field, dataType string) (string, bool, error) {
+	col, path, ok, err := jc.Resolve(field)
+	if !ok || err != nil {
+		return "", ok, err
+	}
+	if declared := col.DataType(path); declared != "" {
+		dataType = declared
+	}
+	if dataType == "" {
+		dataType = JSONText
+	}
+	if d == nil {
+		d = Postgres
+	}
+	return d.JSONPath(col.Column, path, dataType), true, nil
+}
+
+// jsonDataType normalizes data type name into one of JSON data types
+func jsonDataType(name string) string {
+	switch strings.ToLower(name) {
+	case "number", "numeric", "int", "integer", "bigint", "decimal", "float", "double":
+		return JSONNumber
+	case "bool", "boolean":
+		return JSONBoolean
+	case "date", "time", "datetime", "timestamp", "timestamptz":
+		return JSONTimestamp
+	}
+	return JSONText
+}
+
+// jsonPathString return path in $.a.b[0] notation
+func jsonPathString(path []string) string {
+	sb := strings.Builder{}
+	sb.WriteByte(bDollar)
+	for _, key := range path {
+		if key[0] >= '0' && key[0] <= '9' {
+			sb.WriteByte('[')
+			sb.WriteString(key)
+			sb.WriteByte(']')
+		} else {
+			sb.WriteByte('.')
+			sb.WriteString(key)
+		}
+	}
+	return sb.String()
+}
+
+// JSONPath return e.g. (data->'address'->>'age')::numeric
+func (psqlDialect) JSONPath(column string, path []string, dataType string) string {
+	sb := strings.Builder{}
+	sb.WriteString(column)
+	for i, key := range path {
+		if i == len(path)-1 {
+			sb.WriteString("->>")
+		} else {
+			sb.WriteString("->")
+		}
+		if key[0] >= '0' && key[0] <= '9' {
+			sb.WriteString(key)
+		} else {
+			sb.WriteString("'" + key + "'")
+		}
+	}
+
+	switch dataType {
+	case JSONNumber:
+		return "(" + sb.String() + ")::numeric"
+	case JSONBoolean:
+		return "(" + sb.String() + ")::boolean"
+	case JSONTimestamp:
+		return "(" + sb.String() + ")::timestamptz"
+	}
+	return sb.String()
+}
+
+// JSONPath return e.g. JSON_UNQUOTE(JSON_EXTRACT(data, '$.address.city'))
+func (mysqlDialect) JSONPath(column string, path []string, dataType string) string {
+	extract := "JSON_EXTRACT(" + column + ", '" + jsonPathString(path) + "')"
+	switch dataType {
+	case JSONNumber:
+		return "CAST(" + extract + " AS DECIMAL(65,30))"
+	case JSONBoolean:
+		return extract
+	case JSONTimestamp:
+		return "CAST(JSON_UNQUOTE(" + extract + ") AS DATETIME)"
+	}
+	return "JSON_UNQUOTE(" + extract + ")"
+}
+
+// JSONPath return e.g. JSON_EXTRACT(data, '$.address.city'), sqlite returns SQL value of the property
+func (sqliteDialect) JSONPath(column string, path []string, dataType string) string {
+	return "JSON_EXTRACT(" + column + ", '" + jsonPathString(path) + "')"
+}
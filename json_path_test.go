@@ -0,0 +1,90 @@
+package squery_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONColumns(t *testing.T) {
+	dataType := "date"
+	jc := qy.JSONColumns{
+		"data": {
+			Column: "t.data",
+			Properties: map[string]*qy.Property{
+				"birth": {DataType: &dataType},
+			},
+		},
+	}
+	const filter = `{
+		"data.address.city": "Jakarta",
+		"data.age": {"$gte": 18},
+		"data.tags.0": {"$startsWith": "a"},
+		"data.active": true,
+		"data.birth": {"$lt": "2000-01-01"},
+		"name": "putu"
+	}`
+
+	tests := []struct {
+		dialect qy.Dialect
+		clause  string
+	}{
+		{qy.Postgres, `((t.data->'address'->>'city' = ?) AND ((t.data->>'age')::numeric >= ?) AND ` +
+			`(t.data->'tags'->>0 LIKE ? ESCAPE '\') AND ((t.data->>'active')::boolean = ?) AND ` +
+			`((t.data->>'birth')::timestamptz < ?) AND ("name" = ?))`},
+		{qy.MySQL, `((JSON_UNQUOTE(JSON_EXTRACT(t.data, '$.address.city')) = ?) AND ` +
+			`(CAST(JSON_EXTRACT(t.data, '$.age') AS DECIMAL(65,30)) >= ?) AND ` +
+			`(JSON_UNQUOTE(JSON_EXTRACT(t.data, '$.tags[0]')) LIKE ? ESCAPE '\\') AND (JSON_EXTRACT(t.data, '$.active') = ?) AND ` +
+			`(CAST(JSON_UNQUOTE(JSON_EXTRACT(t.data, '$.birth')) AS DATETIME) < ?) AND ("name" = ?))`},
+		{qy.SQLite, `((JSON_EXTRACT(t.data, '$.address.city') = ?) AND (JSON_EXTRACT(t.data, '$.age') >= ?) AND ` +
+			`(JSON_EXTRACT(t.data, '$.tags[0]') LIKE ? ESCAPE '\') AND (JSON_EXTRACT(t.data, '$.active') = ?) AND ` +
+			`(JSON_EXTRACT(t.data, '$.birth') < ?) AND ("name" = ?))`},
+	}
+	fm := func(field string) (string, error) {
+		return `"` + field + `"`, nil
+	}
+	for _, test := range tests {
+		tree, err := qy.NewTree(fm).JSONColumns(jc).Dialect(test.dialect).Parse([]byte(filter))
+		if !assert.NoError(t, err) {
+			return
+		}
+		sb := strings.Builder{}
+		args, err := tree.Build(&sb, qy.NewQmPlaceholder())
+		assert.NoError(t, err)
+		assert.Equal(t, test.clause, sb.String(), test.dialect.Name())
+		assert.Equal(t, []interface{}{"Jakarta", int64(18), "a%", true, "2000-01-01", "putu"}, args)
+	}
+
+	// path is validated by Parse
+	_, err := qy.NewTree(fm).JSONColumns(jc).Parse([]byte(`{"$or": [{"name": "a"}, {"data.a'b": 1}]}`))
+	var errs qy.FilterErrors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs, 1) {
+		assert.Equal(t, "$.$or[1].data.a'b", errs[0].Path)
+		assert.Equal(t, qy.ErrCodeUnknownField, errs[0].Code)
+	}
+}
+
+func TestTemplateListSearchArgJSON(t *testing.T) {
+	listArg := qy.TemplateListSearchArg{
+		ListSearchArg: qy.ListSearchArg{
+			Filter: json.RawMessage(`{"data.age": {"$gt": 30}}`),
+			Fields: []string{"data.address.city"},
+		},
+		JSONColumns: qy.JSONColumns{"data": {Column: "data"}},
+	}
+	tree, err := listArg.FilterTree()
+	if !assert.NoError(t, err) {
+		return
+	}
+	sb := strings.Builder{}
+	_, err = tree.Build(&sb, qy.NewPsqlPlaceholder())
+	assert.NoError(t, err)
+	assert.Equal(t, `((data->>'age')::numeric > $1)`, sb.String())
+
+	cols := listArg.FieldsToColumns()
+	assert.Equal(t, `data->'address'->>'city' AS "data.address.city"`, cols[0].String())
+}
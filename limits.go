@@ -0,0 +1,107 @@
+package squery
+
+import "strconv"
+
+// FilterLimits restricts complexity of user supplied JSON filter.
+// Zero value of a limit means unlimited.
+type FilterLimits struct {
+	MaxDepth        int // maximum nesting level of the filter
+	MaxNodes        int // maximum number of terms and operators
+	MaxInLength     int // maximum number of $in/$nin values
+	MaxStringLength int // maximum length (in bytes) of string value
+	MaxArgs         int // maximum number of bind arguments
+}
+
+// DefaultFilterLimits is reasonable limits for filter coming from public API
+var DefaultFilterLimits = FilterLimits{
+	MaxDepth:        16,
+	MaxNodes:        256,
+	MaxInLength:     1000,
+	MaxStringLength: 4096,
+	MaxArgs:         2000,
+}
+
+// LimitError is returned when the filter exceeds one of the limits
+type LimitError struct {
+	Limit string // name of the limit, e.g. MaxDepth
+	Max   int    // configured limit
+	Value int    // value found in the filter
+}
+
+// Error interface
+func (e *LimitError) Error() string {
+	return "filter exceeds " + e.Limit + " limit (" +
+		strconv.Itoa(e.Value) + " > " + strconv.Itoa(e.Max) + ")"
+}
+
+// limitCounter counts nodes and arguments during parsing
+type limitCounter struct {
+	limits FilterLimits
+	nodes  int
+	args   int
+}
+
+// check return LimitError if value is greater than non-zero max
+func (c *limitCounter) check(limit string, max, value int) error {
+	if max > 0 && value > max {
+		return &LimitError{Limit: limit, Max: max, Value: value}
+	}
+	return nil
+}
+
+// depth checks nesting level
+func (c *limitCounter) depth(level int) error {
+	return c.check("MaxDepth", c.limits.MaxDepth, level)
+}
+
+// addNode counts new node
+func (c *limitCounter) addNode() error {
+	c.nodes++
+	return c.check("MaxNodes", c.limits.MaxNodes, c.nodes)
+}
+
+// element checks n-th element of array value while it is being decoded,
+// inList tells whether the array is list of $in or $nin
+func (c *limitCounter) element(inList bool, n int, v interface{}) error {
+	if inList {
+		if err := c.check("MaxInLength", c.limits.MaxInLength, n); err != nil {
+			return err
+		}
+	}
+	if str, ok := v.(string); ok {
+		if err := c.check("MaxStringLength", c.limits.MaxStringLength, len(str)); err != nil {
+			return err
+		}
+	}
+	return c.check("MaxArgs", c.limits.MaxArgs, c.args+n)
+}
+
+// addValue counts arguments and checks the length of the value
+func (c *limitCounter) addValue(nd *treeNode) error {
+	switch v := nd.Value.(type) {
+	case string:
+		if err := c.check("MaxStringLength", c.limits.MaxStringLength, len(v)); err != nil {
+			return err
+		}
+	case []interface{}:
+		if nd.ValueType == tArray {
+			if err := c.check("MaxInLength", c.limits.MaxInLength, len(v)); err != nil {
+				return err
+			}
+		}
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				if err := c.check("MaxStringLength", c.limits.MaxStringLength, len(str)); err != nil {
+					return err
+				}
+			}
+		}
+		c.args += len(v)
+		return c.check("MaxArgs", c.limits.MaxArgs, c.args)
+	}
+
+	if nd.ValueType != tNull {
+		c.args++
+	}
+	return c.check("MaxArgs", c.limits.MaxArgs, c.args)
+}
@@ -0,0 +1,588 @@
+package squery
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// matchResult is result of SQL three-valued logic, i.e. TRUE, FALSE or UNKNOWN (NULL)
+type matchResult int8
+
+const (
+	matchFalse matchResult = iota
+	matchTrue
+	matchUnknown
+)
+
+func boolMatch(b bool) matchResult {
+	if b {
+		return matchTrue
+	}
+	return matchFalse
+}
+
+func (r matchResult) not() matchResult {
+	switch r {
+	case matchTrue:
+		return matchFalse
+	case matchFalse:
+		return matchTrue
+	}
+	return matchUnknown
+}
+
+func (r matchResult) and(o matchResult) matchResult {
+	if r == matchFalse || o == matchFalse {
+		return matchFalse
+	}
+	if r == matchUnknown || o == matchUnknown {
+		return matchUnknown
+	}
+	return matchTrue
+}
+
+func (r matchResult) or(o matchResult) matchResult {
+	if r == matchTrue || o == matchTrue {
+		return matchTrue
+	}
+	if r == matchUnknown || o == matchUnknown {
+		return matchUnknown
+	}
+	return matchFalse
+}
+
+// Match evaluates the filter against record, i.e. map[string]interface{} or struct (or pointer to it),
+// using the same semantics as the generated SQL, including NULL handling. Struct field is found by
+// its json tag, db tag or name. Nested field, e.g. data.address.city, is looked up in nested maps or structs.
+// Record matches only if the filter evaluates to TRUE. Empty filter matches every record.
+func (t *Tree) Match(record interface{}) (bool, error) {
+	if t.IsEmpty() {
+		return true, nil
+	}
+	r, err := t.root.match(record, nil)
+	if err != nil {
+		return false, err
+	}
+	return r == matchTrue, nil
+}
+
+// match evaluates node against record, field is the nearest field term of the node
+func (fn *treeNode) match(record interface{}, field *treeNode) (matchResult, error) {
+	switch {
+	case fn.isRoot:
+		return fn.matchChildren(record, field, fn.Value == opOr)
+	case fn.isLogical():
+		r, err := fn.matchChildren(record, field, fn.isOr())
+		if fn.isNegation() {
+			r = r.not()
+		}
+		return r, err
+	case !fn.isOperator():
+		if field != nil {
+			return matchUnknown, errors.New(field.Term + ": nested field " + fn.Term + " is not supported")
+		}
+		if len(fn.Children) > 0 {
+			// array of operators is OR operation, as in writeNode
+			return fn.matchChildren(record, fn, fn.Value == opOr)
+		}
+		value := lookupValue(record, fn.Term)
+		if fn.ValueType == tNull {
+			return boolMatch(value == nil), nil
+		}
+		return matchCompare(value, fn.Value, func(c int) bool { return c == 0 })
+	}
+
+	if field == nil {
+		return matchUnknown, errors.New(fn.Term + ": operator must be applied to a field")
+	}
+	value := lookupValue(record, field.Term)
+	if isRelationOperator(fn.Term) {
+		return fn.matchRelation(value, field)
+	}
+	if fn.custom {
+		return matchUnknown, errors.New(field.Term + ": custom operator " + fn.Term + " can not be evaluated in memory")
+	}
+	if len(fn.Children) > 0 {
+		return matchUnknown, errors.New(field.Term + ": " + fn.Term + " operator does not accept object value")
+	}
+	return fn.matchOperation(value)
+}
+
+// matchChildren evaluates children joined with AND or OR
+func (fn *treeNode) matchChildren(record interface{}, field *treeNode, isOr bool) (matchResult, error) {
+	result := boolMatch(!isOr)
+	for _, child := range fn.Children {
+		r, err := child.match(record, field)
+		if err != nil {
+			return matchUnknown, err
+		}
+		if isOr {
+			result = result.or(r)
+		} else {
+			result = result.and(r)
+		}
+	}
+	return result, nil
+}
+
+// matchRelation evaluates $some, $none and $every against slice of child records
+func (fn *treeNode) matchRelation(value interface{}, field *treeNode) (matchResult, error) {
+	if fn.ValueType != tOperator {
+		return matchUnknown, errors.New(field.Term + ": " + fn.Term + " operator needs object value")
+	}
+	rv := reflect.ValueOf(value)
+	if value != nil && rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return matchUnknown, errors.New(field.Term + ": " + fn.Term + " operator needs slice of records")
+	}
+	exists := false
+	for i := 0; value != nil && i < rv.Len() && !exists; i++ {
+		r, err := fn.matchChildren(rv.Index(i).Interface(), nil, false)
+		if err != nil {
+			return matchUnknown, err
+		}
+		if fn.Term == opEvery {
+			// child for which the condition is not TRUE, i.e. FALSE or unknown (NULL)
+			exists = r != matchTrue
+		} else {
+			exists = r == matchTrue
+		}
+	}
+	return boolMatch(exists == (fn.Term == opSome)), nil
+}
+
+// matchOperation evaluates operator node against value of the field
+func (fn *treeNode) matchOperation(value interface{}) (matchResult, error) {
+	switch fn.Term {
+	case opEq, opNeq:
+		if fn.ValueType == tNull {
+			return boolMatch((value == nil) == (fn.Term == opEq)), nil
+		}
+		r, err := matchCompare(value, fn.Value, func(c int) bool { return c == 0 })
+		if fn.Term == opNeq {
+			r = r.not()
+		}
+		return r, err
+	case opGt:
+		return matchCompare(value, fn.Value, func(c int) bool { return c > 0 })
+	case opGte:
+		return matchCompare(value, fn.Value, func(c int) bool { return c >= 0 })
+	case opLt:
+		return matchCompare(value, fn.Value, func(c int) bool { return c < 0 })
+	case opLte:
+		return matchCompare(value, fn.Value, func(c int) bool { return c <= 0 })
+	case opIn, opNotIn:
+		return fn.matchInList(value)
+	case opBetween:
+		arr, ok := fn.Value.([]interface{})
+		if !ok || len(arr) != 2 {
+			return matchUnknown, errors.New("argument for BETWEEN must be an array with 2 elements")
+		}
+		lo, err := matchCompare(value, arr[0], func(c int) bool { return c >= 0 })
+		if err != nil {
+			return matchUnknown, err
+		}
+		hi, err := matchCompare(value, arr[1], func(c int) bool { return c <= 0 })
+		return lo.and(hi), err
+	case opExists:
+		exists, ok := fn.Value.(bool)
+		if !ok {
+			return matchUnknown, errors.New(fn.Term + " operator needs boolean value")
+		}
+		return boolMatch((value != nil) == exists), nil
+	case opIs, opIsNot:
+		var is bool
+		switch v := fn.Value.(type) {
+		case nil:
+			is = value == nil
+		case bool:
+			b, ok := value.(bool)
+			is = ok && b == v
+		default:
+			return matchUnknown, errors.New(fn.Term + " operator needs null or boolean value")
+		}
+		return boolMatch(is == (fn.Term == opIs)), nil
+	case opDistinct, opNotDistinct:
+		same := value == nil && fn.Value == nil
+		if value != nil && fn.Value != nil {
+			r, err := matchCompare(value, fn.Value, func(c int) bool { return c == 0 })
+			if err != nil {
+				return matchUnknown, err
+			}
+			same = r == matchTrue
+		}
+		return boolMatch(same == (fn.Term == opNotDistinct)), nil
+	case opStartsWith, opEndsWith, opContains:
+		pattern, ok := fn.Value.(string)
+		if !ok {
+			return matchUnknown, errors.New(fn.Term + " operator needs string value")
+		}
+		return matchString(value, func(str string) bool {
+			switch fn.Term {
+			case opStartsWith:
+				return strings.HasPrefix(str, pattern)
+			case opEndsWith:
+				return strings.HasSuffix(str, pattern)
+			}
+			return strings.Contains(str, pattern)
+		})
+	case opLike, opNotLike, opILike, opNotILike:
+		return fn.matchRegexp(value, likeToRegexp, fn.Term == opILike || fn.Term == opNotILike,
+			fn.Term == opNotLike || fn.Term == opNotILike)
+	case opSimilarTo, opNotSimilarTo:
+		return fn.matchRegexp(value, similarToRegexp, false, fn.Term == opNotSimilarTo)
+	case opRegex, opIRegex, opNotRegex, opNotIRegex:
+		// regular expression is not anchored, as in postgresql
+		return fn.matchRegexp(value, func(p string) string { return p }, fn.Term == opIRegex || fn.Term == opNotIRegex,
+			fn.Term == opNotRegex || fn.Term == opNotIRegex)
+	}
+	return matchUnknown, errors.New(fn.Term + ": unknown operator")
+}
+
+// matchInList evaluates $in and $nin, NULL in the list matches NULL value
+func (fn *treeNode) matchInList(value interface{}) (matchResult, error) {
+	values, ok := fn.Value.([]interface{})
+	if !ok {
+		return matchUnknown, errors.New(fn.Term + " operator needs array value")
+	}
+	hasNull, nargs := false, 0
+	result := matchFalse
+	for _, v := range values {
+		if v == nil {
+			hasNull = true
+			continue
+		}
+		nargs++
+		r, err := matchCompare(value, v, func(c int) bool { return c == 0 })
+		if err != nil {
+			return matchUnknown, err
+		}
+		result = result.or(r)
+	}
+	if nargs == 0 && !hasNull {
+		// empty list, as written in SQL, i.e. IN is (1=0) and NOT IN is (1=1)
+		return boolMatch(fn.Term == opNotIn), nil
+	}
+	if fn.Term == opIn {
+		if nargs == 0 {
+			return boolMatch(value == nil), nil
+		}
+		if hasNull {
+			result = result.or(boolMatch(value == nil))
+		}
+		return result, nil
+	}
+	if nargs == 0 {
+		return boolMatch(value != nil), nil
+	}
+	result = result.not()
+	if hasNull {
+		result = result.and(boolMatch(value != nil))
+	}
+	return result, nil
+}
+
+// matchRegexp matches value with pattern converted into regular expression
+func (fn *treeNode) matchRegexp(value interface{}, convert func(string) string, ignoreCase, negate bool) (matchResult, error) {
+	pattern, ok := fn.Value.(string)
+	if !ok {
+		return matchUnknown, errors.New(fn.Term + " operator needs string value")
+	}
+	// the expression is compiled once and reused for every record
+	fn.re.once.Do(func() {
+		expr := convert(pattern)
+		if ignoreCase {
+			expr = "(?i)" + expr
+		}
+		fn.re.re, fn.re.err = regexp.Compile(expr)
+	})
+	if fn.re.err != nil {
+		return matchUnknown, errors.New(fn.Term + ": " + fn.re.err.Error())
+	}
+	r, err := matchString(value, fn.re.re.MatchString)
+	if negate {
+		r = r.not()
+	}
+	return r, err
+}
+
+// likeToRegexp converts LIKE pattern into anchored regular expression,
+// backslash is the escape character
+func likeToRegexp(pattern string) string {
+	sb := strings.Builder{}
+	sb.WriteString("(?s)^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case bPercent:
+			sb.WriteString(".*")
+		case bUnderscore:
+			sb.WriteByte('.')
+		case bBackslash:
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	sb.WriteByte(bDollar)
+	return sb.String()
+}
+
+// similarToRegexp converts SIMILAR TO pattern into anchored regular expression
+func similarToRegexp(pattern string) string {
+	sb := strings.Builder{}
+	sb.WriteString("(?s)^(?:")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case bPercent:
+			sb.WriteString(".*")
+		case bUnderscore:
+			sb.WriteByte('.')
+		case '.', '^', '$':
+			sb.WriteByte(bBackslash)
+			sb.WriteByte(c)
+		case bBackslash:
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteString(")$")
+	return sb.String()
+}
+
+// matchString evaluates string value, NULL value is UNKNOWN
+func matchString(value interface{}, fn func(string) bool) (matchResult, error) {
+	if value == nil {
+		return matchUnknown, nil
+	}
+	str, ok := value.(string)
+	if !ok {
+		return matchUnknown, errors.New("value " + toString(value) + " is not a string")
+	}
+	return boolMatch(fn(str)), nil
+}
+
+// matchCompare compares value with arg, NULL value is UNKNOWN
+func matchCompare(value, arg interface{}, fn func(int) bool) (matchResult, error) {
+	if value == nil || arg == nil {
+		return matchUnknown, nil
+	}
+	c, err := compareValues(value, arg)
+	if err != nil {
+		return matchUnknown, err
+	}
+	return boolMatch(fn(c)), nil
+}
+
+// compareValues return -1, 0 or 1 if a is less than, equal or greater than b.
+// Numeric string, e.g. decimal value converted by schema, is compared as number with number.
+func compareValues(a, b interface{}) (int, error) {
+	ra, aNum := toRat(a)
+	rb, bNum := toRat(b)
+	if aNum && !bNum {
+		rb, bNum = stringRat(b)
+	} else if bNum && !aNum {
+		ra, aNum = stringRat(a)
+	}
+	if aNum && bNum {
+		return ra.Cmp(rb), nil
+	}
+
+	switch va := a.(type) {
+	case string:
+		if vb, ok := b.(string); ok {
+			return strings.Compare(va, vb), nil
+		}
+	case bool:
+		if vb, ok := b.(bool); ok {
+			switch {
+			case va == vb:
+				return 0, nil
+			case vb:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	case time.Time:
+		vb, ok := b.(time.Time)
+		if str, isStr := b.(string); isStr {
+			var err error
+			vb, err = time.Parse(time.RFC3339, str)
+			ok = err == nil
+		}
+		if ok {
+			switch {
+			case va.Before(vb):
+				return -1, nil
+			case va.After(vb):
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, errors.New("can not compare " + toString(a) + " with " + toString(b))
+}
+
+// toRat converts number into rational number
+func toRat(v interface{}) (*big.Rat, bool) {
+	switch n := v.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(n), true
+	case json.Number:
+		return new(big.Rat).SetString(string(n))
+	case string:
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Rat).SetInt64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(rv.Uint())), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(f), true
+	}
+	return nil, false
+}
+
+// stringRat converts numeric string into rational number
+func stringRat(v interface{}) (*big.Rat, bool) {
+	str, ok := v.(string)
+	if !ok {
+		return nil, false
+	}
+	return new(big.Rat).SetString(str)
+}
+
+// toString return string representation of value used in error message
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return strconv.Quote(s)
+	case Stringer:
+		return s.String()
+	}
+	return reflect.TypeOf(v).String()
+}
+
+// lookupValue return value of field in record, nil is returned if the field does not exist.
+// Nested field is looked up by splitting the field at '.'.
+func lookupValue(record interface{}, field string) interface{} {
+	if v, ok := lookupKey(record, field); ok {
+		return v
+	}
+	keys := strings.Split(field, ".")
+	if len(keys) == 1 {
+		return nil
+	}
+	v := record
+	for _, key := range keys {
+		var ok bool
+		if v, ok = lookupKey(v, key); !ok {
+			return nil
+		}
+	}
+	return v
+}
+
+// lookupKey return value of single key in map, struct or slice (numeric key)
+func lookupKey(record interface{}, key string) (interface{}, bool) {
+	rv := reflect.ValueOf(record)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		item := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+		if !item.IsValid() {
+			return nil, false
+		}
+		return normalizeRecordValue(item), true
+	case reflect.Struct:
+		if item, ok := structField(rv, key); ok {
+			return normalizeRecordValue(item), true
+		}
+	case reflect.Slice, reflect.Array:
+		if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < rv.Len() {
+			return normalizeRecordValue(rv.Index(idx)), true
+		}
+	}
+	return nil, false
+}
+
+// structField finds exported field by json tag, db tag or name (case insensitive)
+func structField(rv reflect.Value, key string) (reflect.Value, bool) {
+	rt := rv.Type()
+	byName := -1
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		for _, tag := range []string{"json", "db"} {
+			if name := strings.Split(sf.Tag.Get(tag), ",")[0]; name == key {
+				return rv.Field(i), true
+			}
+		}
+		if byName < 0 && strings.EqualFold(sf.Name, key) {
+			byName = i
+		}
+	}
+	if byName >= 0 {
+		return rv.Field(byName), true
+	}
+	return reflect.Value{}, false
+}
+
+// normalizeRecordValue dereferences pointer and converts driver.Valuer, e.g. sql.NullString.
+// nil pointer and NULL value are returned as nil.
+func normalizeRecordValue(rv reflect.Value) interface{} {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		if valuer, ok := rv.Interface().(driver.Valuer); ok {
+			return valuerValue(valuer)
+		}
+		rv = rv.Elem()
+	}
+	if !rv.CanInterface() {
+		return nil
+	}
+	v := rv.Interface()
+	if valuer, ok := v.(driver.Valuer); ok {
+		return valuerValue(valuer)
+	}
+	return v
+}
+
+func valuerValue(valuer driver.Valuer) interface{} {
+	v, err := valuer.Value()
+	if err != nil {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,158 @@
+package squery_test
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+type matchOrder struct {
+	Total  float64 `json:"total"`
+	Status string  `db:"status"`
+}
+
+type matchPerson struct {
+	Name    string         `json:"name"`
+	Age     *int           `json:"age"`
+	Email   sql.NullString `json:"email"`
+	Active  bool
+	Address map[string]interface{} `json:"address"`
+	Orders  []matchOrder           `json:"orders"`
+}
+
+func TestTreeMatch(t *testing.T) {
+	age := 30
+	record := map[string]interface{}{
+		"name":   "Putu_Kali",
+		"age":    30,
+		"score":  12.5,
+		"email":  nil,
+		"active": true,
+		"tags":   []interface{}{"a"},
+		"data":   map[string]interface{}{"address": map[string]interface{}{"city": "Denpasar"}},
+	}
+	person := &matchPerson{
+		Name:    "Putu_Kali",
+		Age:     &age,
+		Active:  true,
+		Address: map[string]interface{}{"city": "Denpasar"},
+		Orders:  []matchOrder{{Total: 150, Status: "paid"}, {Total: 50, Status: "open"}},
+	}
+
+	tests := []struct {
+		filter     string
+		match      bool
+		structOnly bool
+	}{
+		{`{}`, true, false},
+		{`{"name": "Putu_Kali", "age": 30}`, true, false},
+		{`{"age": {"$gt": 18, "$lt": 30}}`, false, false},
+		{`{"age": {"$between": [30, 40]}}`, true, false},
+		{`{"age": {"$in": [1, 30]}}`, true, false},
+		{`{"age": {"$nin": [30, null]}}`, false, false},
+		{`{"age": {"$in": []}}`, false, false},
+		{`{"age": {"$nin": []}}`, true, false},
+		{`{"name": {"$like": "Putu%"}}`, true, false},
+		{`{"name": {"$like": "putu%"}}`, false, false},
+		{`{"name": {"$ilike": "putu\\_%"}}`, true, false},
+		{`{"name": {"$like": "Putu\\_Kal_"}}`, true, false},
+		{`{"name": {"$startsWith": "Putu_"}}`, true, false},
+		{`{"name": {"$regex": "^P.*i$"}}`, true, false},
+		{`{"name": {"$similarto": "(Putu|Made)%"}}`, true, false},
+		{`{"email": null}`, true, false},
+		{`{"email": {"$eq": "x"}}`, false, false},
+		{`{"email": {"$neq": "x"}}`, false, false},
+		{`{"$not": {"email": "x"}}`, false, false},
+		{`{"email": {"$isDistinctFrom": "x"}}`, true, false},
+		{`{"email": {"$in": ["x", null]}}`, true, false},
+		{`{"email": {"$exists": false}}`, true, false},
+		{`{"active": {"$is": true}}`, true, false},
+		{`{"$or": [{"email": "x"}, {"age": 30}]}`, true, false},
+		{`{"age": [{"$lt": 18}, {"$gt": 25}]}`, true, false},
+		{`{"age": [{"$lt": 18}, {"$gt": 35}]}`, false, false},
+		{`{"$nor": [{"email": "x"}, {"age": 31}]}`, false, false},
+		{`{"$nor": [{"name": "x"}, {"age": 31}]}`, true, false},
+		{`{"address.city": "Denpasar"}`, true, true},
+		{`{"orders": {"$some": {"total": {"$gt": 100}, "status": "paid"}}}`, true, true},
+		{`{"orders": {"$every": {"total": {"$gt": 100}}}}`, false, true},
+		{`{"orders": {"$none": {"status": "cancel"}}}`, true, true},
+	}
+	for _, test := range tests {
+		tree, err := qy.NewTree(nil).Parse([]byte(test.filter))
+		if !assert.NoError(t, err, test.filter) {
+			continue
+		}
+		ok, err := tree.Match(person)
+		assert.NoError(t, err, test.filter)
+		assert.Equal(t, test.match, ok, test.filter)
+
+		if test.structOnly {
+			continue
+		}
+		ok, err = tree.Match(record)
+		assert.NoError(t, err, test.filter)
+		assert.Equal(t, test.match, ok, "map: "+test.filter)
+	}
+
+	// child whose condition is unknown, i.e. NULL column, fails $every as in SQL
+	orders := map[string]interface{}{
+		"orders": []interface{}{
+			map[string]interface{}{"status": "paid"},
+			map[string]interface{}{"status": nil},
+		},
+	}
+	tree, err := qy.NewTree(nil).Parse([]byte(`{"orders": {"$every": {"status": {"$neq": "open"}}}}`))
+	if assert.NoError(t, err) {
+		ok, err := tree.Match(orders)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	}
+	tree, err = qy.NewTree(nil).Parse([]byte(`{"orders": {"$none": {"status": {"$eq": "open"}}}}`))
+	if assert.NoError(t, err) {
+		ok, err := tree.Match(orders)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	tree, err = qy.NewTree(nil).Parse([]byte(`{"data.address.city": {"$in": ["Denpasar"]}, "score": {"$gte": 12.5}}`))
+	if assert.NoError(t, err) {
+		ok, err := tree.Match(record)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	tree, err = qy.NewTree(nil).Parse([]byte(`{"name": {"$gt": 1}}`))
+	if assert.NoError(t, err) {
+		_, err = tree.Match(record)
+		assert.Error(t, err)
+	}
+
+	// compiled expression is reused by every record, also by concurrent calls
+	tree, err = qy.NewTree(nil).Parse([]byte(`{"name": {"$ilike": "%kali"}}`))
+	if assert.NoError(t, err) {
+		var wg sync.WaitGroup
+		for _, name := range []string{"Putu_Kali", "Made", "KALI", "Kalimat"} {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				ok, err := tree.Match(map[string]interface{}{"name": name})
+				assert.NoError(t, err)
+				assert.Equal(t, strings.HasSuffix(strings.ToLower(name), "kali"), ok, name)
+			}(name)
+		}
+		wg.Wait()
+	}
+
+	// invalid expression is reported for every record
+	tree, err = qy.NewTree(nil).Parse([]byte(`{"name": {"$regex": "("}}`))
+	if assert.NoError(t, err) {
+		for i := 0; i < 2; i++ {
+			_, err = tree.Match(record)
+			assert.Error(t, err)
+		}
+	}
+}
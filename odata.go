@@ -0,0 +1,492 @@
+package squery
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// System query options of OData
+const (
+	ODataFilterKey  = "$filter"
+	ODataOrderByKey = "$orderby"
+	ODataTopKey     = "$top"
+	ODataSkipKey    = "$skip"
+	ODataSelectKey  = "$select"
+	ODataCountKey   = "$count"
+)
+
+// ODataError is parse error of OData $filter
+type ODataError struct {
+	Offset  int    // byte offset in the $filter
+	Message string // description of the error
+}
+
+// Error interface
+func (e *ODataError) Error() string {
+	return "odata: " + e.Message + " at offset " + strconv.Itoa(e.Offset)
+}
+
+// ODataQuery is search argument of OData query
+type ODataQuery struct {
+	ListSearchArg
+	Count bool `json:"count"` // $count=true, total number of records is requested
+}
+
+// odataOperators maps comparison operator of OData into filter operator
+var odataOperators = map[string]string{
+	"eq": opEq,
+	"ne": opNeq,
+	"gt": opGt,
+	"ge": opGte,
+	"lt": opLt,
+	"le": opLte,
+	"in": opIn,
+}
+
+// ParseODataQuery converts OData system query options, e.g.
+//
+//	$filter=Price lt 10 and contains(tolower(Name),'milk')&$orderby=Name desc&$top=20&$skip=40&$select=ID,Name&$count=true
+//
+// into ODataQuery. $filter is converted using ODataToJSON, $orderby into Sorts,
+// $top and $skip into Pagination (PerPage and Skip of the first page) and $select into Fields.
+// Other query parameters are ignored, other system query option, e.g. $expand, is an error.
+func ParseODataQuery(values url.Values) (*ODataQuery, error) {
+	q := &ODataQuery{}
+	var top, skip int64
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := strings.TrimSpace(lastValue(values[key]))
+		switch key {
+		case ODataFilterKey:
+			data, err := ODataToJSON(val)
+			if err != nil {
+				return nil, err
+			}
+			q.Filter = data
+		case ODataOrderByKey:
+			sorts, err := odataOrderBy(val)
+			if err != nil {
+				return nil, err
+			}
+			q.Sorts = sorts
+		case ODataTopKey, ODataSkipKey:
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid " + key + " value " + val)
+			}
+			if key == ODataTopKey {
+				top = n
+			} else {
+				skip = n
+			}
+		case ODataSelectKey:
+			q.Fields = nil
+			for _, field := range splitValues([]string{val}) {
+				if field == "*" {
+					q.Fields = nil
+					break
+				}
+				q.Fields = append(q.Fields, odataField(field))
+			}
+		case ODataCountKey:
+			count, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, errors.New("invalid " + key + " value " + val)
+			}
+			q.Count = count
+		default:
+			if strings.HasPrefix(key, "$") {
+				return nil, errors.New("query option " + key + " is not supported")
+			}
+		}
+	}
+
+	if top > 0 || skip > 0 {
+		// $skip is not necessarily multiple of $top, e.g. $top=10&$skip=15
+		q.Pagination = &Pagination{Page: 1, PerPage: top, Skip: skip}
+	}
+	return q, nil
+}
+
+// ParseOData converts OData $filter, e.g. Price lt 10 and startswith(Name,'A'), into the tree.
+// The filter is parsed the same way as ParseRSQL. Syntax error is returned as *ODataError.
+func (t *Tree) ParseOData(filter string) (*Tree, error) {
+	data, err := ODataToJSON(filter)
+	if err != nil {
+		return nil, err
+	}
+	return t.Parse(data)
+}
+
+// ODataToJSON converts OData $filter into JSON filter. Supported are comparison operators
+// (eq, ne, gt, ge, lt, le, in), logical operators (and, or, not) and functions contains,
+// startswith and endswith, which are converted into LIKE. Field wrapped with tolower is compared
+// with eq or ne case-insensitively, i.e. using ILIKE without wildcard, value containing uppercase
+// letter never equals. Navigation path A/B is written as A.B.
+func ODataToJSON(filter string) (json.RawMessage, error) {
+	p := odataParser{query: filter}
+	if p.peek().kind == odataEOF {
+		return nil, nil
+	}
+	obj, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != odataEOF {
+		return nil, p.errorAt(tok, "unexpected "+strconv.Quote(tok.text))
+	}
+	return json.Marshal(obj)
+}
+
+// odataOrderBy converts $orderby, e.g. Name desc,Price, into sort conditions
+func odataOrderBy(orderBy string) (SortConditions, error) {
+	sorts := SortConditions{}
+	for _, item := range splitValues([]string{orderBy}) {
+		parts := strings.Fields(item)
+		order := AscendingOrder
+		if len(parts) == 2 {
+			switch strings.ToLower(parts[1]) {
+			case "asc":
+			case "desc":
+				order = DescendingOrder
+			default:
+				return nil, errors.New("invalid " + ODataOrderByKey + " direction " + parts[1])
+			}
+		} else if len(parts) != 1 {
+			return nil, errors.New("invalid " + ODataOrderByKey + " item " + item)
+		}
+		sorts = append(sorts, &Sort{Fields: []string{odataField(parts[0])}, Order: order})
+	}
+	return sorts, nil
+}
+
+// odataField converts navigation path A/B into A.B
+func odataField(field string) string {
+	return strings.ReplaceAll(field, "/", ".")
+}
+
+// token kinds of OData $filter
+const (
+	odataEOF = iota
+	odataIdent
+	odataLiteral
+	odataString
+	odataLParen
+	odataRParen
+	odataComma
+	odataInvalid
+)
+
+type odataToken struct {
+	kind   int
+	text   string
+	offset int
+}
+
+// odataParser is recursive descent parser of OData $filter
+type odataParser struct {
+	query string
+	pos   int
+	tok   *odataToken
+}
+
+func (p *odataParser) errorAt(tok odataToken, msg string) error {
+	if tok.kind == odataInvalid {
+		msg = "unterminated string literal"
+	}
+	return &ODataError{Offset: tok.offset, Message: msg}
+}
+
+// peek return next token without consuming it
+func (p *odataParser) peek() odataToken {
+	if p.tok == nil {
+		tok := p.scan()
+		p.tok = &tok
+	}
+	return *p.tok
+}
+
+// next consumes next token
+func (p *odataParser) next() odataToken {
+	tok := p.peek()
+	p.tok = nil
+	return tok
+}
+
+// keyword consumes next token if it is the keyword
+func (p *odataParser) keyword(kw string) bool {
+	if tok := p.peek(); tok.kind == odataIdent && strings.EqualFold(tok.text, kw) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *odataParser) expect(kind int, what string) (odataToken, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		return tok, p.errorAt(tok, "expected "+what)
+	}
+	return tok, nil
+}
+
+// scan reads token starting from current position
+func (p *odataParser) scan() odataToken {
+	for p.pos < len(p.query) && isRSQLSpace(p.query[p.pos]) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.query) {
+		return odataToken{kind: odataEOF, offset: start}
+	}
+	switch c := p.query[p.pos]; c {
+	case bLParenthesis:
+		p.pos++
+		return odataToken{kind: odataLParen, text: "(", offset: start}
+	case bRParenthesis:
+		p.pos++
+		return odataToken{kind: odataRParen, text: ")", offset: start}
+	case bComma:
+		p.pos++
+		return odataToken{kind: odataComma, text: ",", offset: start}
+	case '\'':
+		// string literal, quote is escaped by doubling it
+		sb := strings.Builder{}
+		for p.pos++; p.pos < len(p.query); p.pos++ {
+			if p.query[p.pos] != '\'' {
+				sb.WriteByte(p.query[p.pos])
+				continue
+			}
+			if p.pos+1 < len(p.query) && p.query[p.pos+1] == '\'' {
+				sb.WriteByte('\'')
+				p.pos++
+				continue
+			}
+			p.pos++
+			return odataToken{kind: odataString, text: sb.String(), offset: start}
+		}
+		p.pos = len(p.query)
+		return odataToken{kind: odataInvalid, text: p.query[start:], offset: start}
+	}
+	for p.pos < len(p.query) && !isRSQLSpace(p.query[p.pos]) && strings.IndexByte("(),'", p.query[p.pos]) < 0 {
+		p.pos++
+	}
+	text := p.query[start:p.pos]
+	if c := text[0]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' {
+		switch text {
+		case "true", "false", "null":
+			return odataToken{kind: odataLiteral, text: text, offset: start}
+		}
+		return odataToken{kind: odataIdent, text: text, offset: start}
+	}
+	return odataToken{kind: odataLiteral, text: text, offset: start}
+}
+
+// or := and ('or' and)*
+func (p *odataParser) parseOr() (filterObject, error) {
+	items := []filterObject{}
+	for {
+		obj, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, obj)
+		if !p.keyword("or") {
+			break
+		}
+	}
+	return orFilter(items), nil
+}
+
+// and := unary ('and' unary)*
+func (p *odataParser) parseAnd() (filterObject, error) {
+	items := []filterObject{}
+	for {
+		obj, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, obj)
+		if !p.keyword("and") {
+			break
+		}
+	}
+	return andFilter(items), nil
+}
+
+// unary := 'not' unary | '(' or ')' | function | comparison
+func (p *odataParser) parseUnary() (filterObject, error) {
+	if p.keyword("not") {
+		obj, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return filterObject{{key: opNot, value: obj}}, nil
+	}
+	tok := p.peek()
+	switch tok.kind {
+	case odataLParen:
+		p.next()
+		obj, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(odataRParen, "closing parenthesis"); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case odataIdent:
+		switch strings.ToLower(tok.text) {
+		case "contains", "startswith", "endswith":
+			return p.parseFunction()
+		}
+		return p.parseComparison()
+	}
+	return nil, p.errorAt(tok, "expected field or function")
+}
+
+// function := name '(' operand ',' string ')'
+func (p *odataParser) parseFunction() (filterObject, error) {
+	name := strings.ToLower(p.next().text)
+	if _, err := p.expect(odataLParen, "opening parenthesis"); err != nil {
+		return nil, err
+	}
+	field, lower, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(odataComma, "comma"); err != nil {
+		return nil, err
+	}
+	arg, err := p.expect(odataString, "string argument of "+name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(odataRParen, "closing parenthesis"); err != nil {
+		return nil, err
+	}
+
+	pattern := escapeLike(arg.text)
+	switch name {
+	case "contains":
+		pattern = "%" + pattern + "%"
+	case "startswith":
+		pattern = pattern + "%"
+	case "endswith":
+		pattern = "%" + pattern
+	}
+	op := opLike
+	if lower {
+		op = opILike
+	}
+	return filterObject{{key: field, value: filterObject{{key: op, value: pattern}}}}, nil
+}
+
+// comparison := operand op literal | operand 'in' '(' literal (',' literal)* ')'
+func (p *odataParser) parseComparison() (filterObject, error) {
+	field, lower, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	opTok := p.next()
+	op, ok := odataOperators[strings.ToLower(opTok.text)]
+	if opTok.kind != odataIdent || !ok {
+		return nil, p.errorAt(opTok, "expected comparison operator")
+	}
+
+	var value interface{}
+	if op == opIn {
+		if _, err := p.expect(odataLParen, "opening parenthesis"); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for {
+			v, err := p.parseLiteral()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if p.peek().kind != odataComma {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(odataRParen, "closing parenthesis"); err != nil {
+			return nil, err
+		}
+		value = list
+	} else if value, err = p.parseLiteral(); err != nil {
+		return nil, err
+	}
+
+	if lower {
+		str, ok := value.(string)
+		if !ok || (op != opEq && op != opNeq) {
+			return nil, p.errorAt(opTok, "tolower only supports eq and ne with string value")
+		}
+		return odataLowerCompare(field, op, str), nil
+	}
+	if op == opEq {
+		return filterObject{{key: field, value: value}}, nil
+	}
+	return filterObject{{key: field, value: filterObject{{key: op, value: value}}}}, nil
+}
+
+// odataLowerCompare converts tolower(field) eq 'value' and ne. Lowercase value is compared
+// case-insensitively using ILIKE with escaped wildcards, i.e. without pattern. Lowercase field
+// never equals value containing uppercase letter, so eq never matches and ne matches non-null field.
+func odataLowerCompare(field, op, value string) filterObject {
+	var cond filterObject
+	switch {
+	case value == strings.ToLower(value) && op == opEq:
+		cond = filterObject{{key: opILike, value: escapeLike(value)}}
+	case value == strings.ToLower(value):
+		cond = filterObject{{key: opNotILike, value: escapeLike(value)}}
+	case op == opEq:
+		cond = filterObject{{key: opIn, value: []interface{}{}}}
+	default:
+		cond = filterObject{{key: opExists, value: true}}
+	}
+	return filterObject{{key: field, value: cond}}
+}
+
+// operand := field | 'tolower' '(' field ')'
+func (p *odataParser) parseOperand() (string, bool, error) {
+	tok, err := p.expect(odataIdent, "field")
+	if err != nil {
+		return "", false, err
+	}
+	if !strings.EqualFold(tok.text, "tolower") || p.peek().kind != odataLParen {
+		return odataField(tok.text), false, nil
+	}
+	p.next()
+	field, err := p.expect(odataIdent, "field")
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := p.expect(odataRParen, "closing parenthesis"); err != nil {
+		return "", false, err
+	}
+	return odataField(field.text), true, nil
+}
+
+// parseLiteral converts string, number, boolean and null literal. Other unquoted literal,
+// e.g. date time or guid, is kept as string.
+func (p *odataParser) parseLiteral() (interface{}, error) {
+	tok := p.next()
+	switch tok.kind {
+	case odataString:
+		return tok.text, nil
+	case odataLiteral:
+		return urlScalar(tok.text), nil
+	}
+	return nil, p.errorAt(tok, "expected literal value")
+}
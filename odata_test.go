@@ -0,0 +1,103 @@
+package squery_test
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOData(t *testing.T) {
+	tests := []struct {
+		filter string
+		json   string
+	}{
+		{`Price lt 10 and contains(tolower(Name),'mi_lk')`,
+			`{"Price":{"$lt":10},"Name":{"$ilike":"%mi\\_lk%"}}`},
+		{`Name eq 'O''Neil' or (Age ge 18 and Address/City ne null)`,
+			`{"$or":[{"Name":"O'Neil"},{"$and":{"Age":{"$gte":18},"Address.City":{"$neq":null}}}]}`},
+		{`not startswith(Code,'A') and endswith(Code,'z')`,
+			`{"$not":{"Code":{"$like":"A%"}},"Code":{"$like":"%z"}}`},
+		{`Status in ('A', 'B') and Active eq true and tolower(Name) ne 'x%'`,
+			`{"Status":{"$in":["A","B"]},"Active":true,"Name":{"$nilike":"x\\%"}}`},
+		{`tolower(Name) eq 'milk'`, `{"Name":{"$ilike":"milk"}}`},
+		{`tolower(Name) eq 'Milk'`, `{"Name":{"$in":[]}}`},
+		{`tolower(Name) ne 'Milk'`, `{"Name":{"$exists":true}}`},
+		{`Created gt 2021-05-01T00:00:00Z`, `{"Created":{"$gt":"2021-05-01T00:00:00Z"}}`},
+		{` `, ``},
+	}
+	for _, test := range tests {
+		data, err := qy.ODataToJSON(test.filter)
+		if assert.NoError(t, err, test.filter) {
+			assert.Equal(t, test.json, string(data), test.filter)
+		}
+	}
+
+	fm := func(field string) (string, error) {
+		return `"` + strings.ToLower(field) + `"`, nil
+	}
+	tree, err := qy.NewTree(fm).ParseOData(`Price lt 10 or Name eq 'milk'`)
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		args, err := tree.Build(&sb, qy.NewQmPlaceholder())
+		assert.NoError(t, err)
+		assert.Equal(t, `(("price" < ?) OR ("name" = ?))`, sb.String())
+		assert.Equal(t, []interface{}{int64(10), "milk"}, args)
+	}
+
+	// lower case of a value is never equal to upper case text
+	tree, err = qy.NewTree(nil).ParseOData(`tolower(Name) eq 'Milk'`)
+	if assert.NoError(t, err) {
+		ok, err := tree.Match(map[string]interface{}{"Name": "Milk"})
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	}
+
+	for _, filter := range []string{`Name eq`, `Name foo 1`, `(Age eq 1`, `contains(Name)`,
+		`tolower(Age) gt 1`, `Name eq 'abc`, `Age eq 1 Name`} {
+		_, err := qy.ODataToJSON(filter)
+		var oe *qy.ODataError
+		assert.True(t, errors.As(err, &oe), filter)
+	}
+}
+
+func TestParseODataQuery(t *testing.T) {
+	values, err := url.ParseQuery("$filter=Price lt 10&$orderby=Name desc,Address/City&$top=20&$skip=40" +
+		"&$select=ID,Name&$count=true&other=1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	q, err := qy.ParseODataQuery(values)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `{"Price":{"$lt":10}}`, string(q.Filter))
+	assert.Equal(t, qy.SortConditions{
+		{Fields: []string{"Name"}, Order: qy.DescendingOrder},
+		{Fields: []string{"Address.City"}, Order: qy.AscendingOrder},
+	}, q.Sorts)
+	assert.Equal(t, &qy.Pagination{Page: 1, PerPage: 20, Skip: 40}, q.Pagination)
+	q.Pagination.Calculate(100)
+	assert.Equal(t, int64(40), q.Pagination.Offset())
+	assert.Equal(t, []string{"ID", "Name"}, q.Fields)
+	assert.True(t, q.Count)
+
+	// $skip is not multiple of $top
+	values, _ = url.ParseQuery("$top=10&$skip=15")
+	q, err = qy.ParseODataQuery(values)
+	if assert.NoError(t, err) {
+		q.Pagination.Calculate(100)
+		assert.Equal(t, int64(15), q.Pagination.Offset())
+		assert.Equal(t, int64(10), q.Pagination.Limit())
+	}
+
+	for _, query := range []string{"$skip=-10", "$top=-1", "$count=x",
+		"$orderby=Name up", "$expand=Orders"} {
+		values, _ := url.ParseQuery(query)
+		_, err := qy.ParseODataQuery(values)
+		assert.Error(t, err, query)
+	}
+}
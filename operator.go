@@ -0,0 +1,95 @@
+package squery
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// OperatorFunc writes custom operator applied to the mapped SQL field, e.g. $near.
+// value is the decoded JSON value of the operator (numbers are int64, float64 or
+// big integer string, objects are map[string]interface{}).
+// Placeholder must be used for every returned argument.
+type OperatorFunc func(field string, value interface{}, ph Placeholder) (string, []interface{}, error)
+
+// Operators maps operator name (starting with '$') to its function
+type Operators map[string]OperatorFunc
+
+// register operator, built-in operators can not be replaced
+func (ops Operators) register(op string, fn OperatorFunc) error {
+	if !strings.HasPrefix(op, "$") {
+		return errors.New("operator " + op + " must start with $")
+	}
+	if _, ok := opToSQL[op]; ok || isRelationOperator(op) {
+		return errors.New("operator " + op + " is built-in operator")
+	}
+	if fn == nil {
+		return errors.New("operator " + op + " has nil function")
+	}
+	ops[op] = fn
+	return nil
+}
+
+// lookup return function of custom operator
+func (ops Operators) lookup(op string) (OperatorFunc, bool) {
+	fn, ok := ops[op]
+	return fn, ok
+}
+
+// merge return operators of ops and others, others take precedence
+func (ops Operators) merge(others Operators) Operators {
+	if len(others) == 0 {
+		return ops
+	}
+	if len(ops) == 0 {
+		return others
+	}
+	merged := make(Operators, len(ops)+len(others))
+	for op, fn := range ops {
+		merged[op] = fn
+	}
+	for op, fn := range others {
+		merged[op] = fn
+	}
+	return merged
+}
+
+// normalizeValue converts json.Number inside decoded value
+func normalizeValue(v interface{}) (interface{}, error) {
+	var err error
+	switch val := v.(type) {
+	case json.Number:
+		return numberValue(val)
+	case []interface{}:
+		for i, item := range val {
+			if val[i], err = normalizeValue(item); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for key, item := range val {
+			if val[key], err = normalizeValue(item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// writeCustomOperation writes custom operator applied to the field
+func (fn *treeNode) writeCustomOperation(sb StringBuilder, arg *SqlExpression, field *treeNode, opFn OperatorFunc) error {
+	sqlField, err := field.mapField(arg, fn.jsonDataType())
+	if err != nil {
+		return err
+	}
+	clause, args, err := opFn(sqlField, fn.Value, arg.ph)
+	if err != nil {
+		return errors.New(field.Term + ": " + fn.Term + ": " + err.Error())
+	}
+	sb.WriteByte(bLParenthesis)
+	sb.WriteString(clause)
+	sb.WriteByte(bRParenthesis)
+	arg.Args = append(arg.Args, args...)
+
+	return nil
+}
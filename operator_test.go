@@ -0,0 +1,86 @@
+package squery_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+func nearOperator(field string, value interface{}, ph qy.Placeholder) (string, []interface{}, error) {
+	v, ok := value.(map[string]interface{})
+	if !ok {
+		return "", nil, errors.New("value must be an object")
+	}
+	sql := "ST_DWithin(" + field + ", ST_MakePoint(" + ph.Next() + ", " + ph.Next() + "), " + ph.Next() + ")"
+	return sql, []interface{}{v["lng"], v["lat"], v["radius"]}, nil
+}
+
+func TestTreeCustomOperator(t *testing.T) {
+	filter := `{"name": "A", "loc": {"$near": {"lat": 1.5, "lng": 2, "radius": 100}}}`
+	tree, err := qy.NewTree(nil).RegisterOperator("$near", nearOperator).Parse([]byte(filter))
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		args, err := tree.Build(&sb, qy.NewPsqlPlaceholder())
+		assert.NoError(t, err)
+		assert.Equal(t, `((name = $1) AND (ST_DWithin(loc, ST_MakePoint($2, $3), $4)))`, sb.String())
+		assert.Equal(t, []interface{}{"A", int64(2), 1.5, int64(100)}, args)
+	}
+
+	// operator is not registered
+	_, err = qy.NewTree(nil).Parse([]byte(filter))
+	assert.EqualError(t, err, "$.loc.$near: unknown operator $near")
+
+	// error of the operator
+	tree, err = qy.NewTree(nil).RegisterOperator("$near", nearOperator).Parse([]byte(`{"loc": {"$near": 1}}`))
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		_, err = tree.Build(&sb, qy.NewPsqlPlaceholder())
+		assert.EqualError(t, err, "loc: $near: value must be an object")
+	}
+
+	assert.Panics(t, func() { qy.NewTree(nil).RegisterOperator("$eq", nearOperator) })
+	assert.Panics(t, func() { qy.NewTree(nil).RegisterOperator("near", nearOperator) })
+}
+
+func TestSchemaCustomOperator(t *testing.T) {
+	schema := qy.NewFilterSchema().
+		RegisterOperator("$near", nearOperator).
+		Field("loc", qy.FieldSchema{Type: qy.FieldText, Column: "l.geom"}).
+		Field("name", qy.FieldSchema{Type: qy.FieldText, Operators: []string{"$eq"}})
+
+	tree, err := qy.NewTree(nil).Schema(schema).Parse([]byte(`{"loc": {"$near": {"lat": 1, "lng": 2, "radius": 3}}}`))
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		args, err := tree.Build(&sb, qy.NewQmPlaceholder())
+		assert.NoError(t, err)
+		assert.Equal(t, `(ST_DWithin(l.geom, ST_MakePoint(?, ?), ?))`, sb.String())
+		assert.Equal(t, []interface{}{int64(2), int64(1), int64(3)}, args)
+	}
+
+	_, err = qy.NewTree(nil).Schema(schema).Parse([]byte(`{"name": {"$near": {}}}`))
+	assert.EqualError(t, err, "$.name.$near: operator $near not allowed")
+}
+
+func TestSchemaTreeCustomOperators(t *testing.T) {
+	schema := qy.NewFilterSchema().
+		RegisterOperator("$near", nearOperator).
+		Field("loc", qy.FieldSchema{Type: qy.FieldText}).
+		Field("tags", qy.FieldSchema{Type: qy.FieldText})
+	overlap := func(field string, value interface{}, ph qy.Placeholder) (string, []interface{}, error) {
+		return field + " && " + ph.Next(), []interface{}{value}, nil
+	}
+
+	// operators of the schema and the tree are both available
+	filter := `{"loc": {"$near": {"lat": 1, "lng": 2, "radius": 3}}, "tags": {"$overlap": "a"}}`
+	tree, err := qy.NewTree(nil).Schema(schema).RegisterOperator("$overlap", overlap).Parse([]byte(filter))
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		args, err := tree.Build(&sb, qy.NewQmPlaceholder())
+		assert.NoError(t, err)
+		assert.Equal(t, `((ST_DWithin("loc", ST_MakePoint(?, ?), ?)) AND ("tags" && ?))`, sb.String())
+		assert.Equal(t, []interface{}{int64(2), int64(1), int64(3), "a"}, args)
+	}
+}
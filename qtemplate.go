@@ -3,20 +3,43 @@ package squery
 import (
 	"errors"
 	"reflect"
-	"strconv"
+	"regexp"
 	"strings"
 )
 
+// reInKeyword matches IN/NOT IN operator at the end of template text
+var reInKeyword = regexp.MustCompile(`(?i)\b(NOT\s+)?IN\s*$`)
+
 // FieldValues stores filed: value for db
 type FieldValues map[string]interface{}
 
+// TemplateQuery is query builder backed by SQL template.
+// Besides default {{WHERE}} and {{HAVING}}, the template may contain named slots,
+// e.g. {{WHERE:inner}} and {{HAVING:outer}}, which are filled by WhereIn and HavingIn.
+// Bare expression can be placed anywhere with {{EXPR:name}} and filled by ExprIn.
+type TemplateQuery interface {
+	Query
+	WhereIn(slot string, expr Expression) TemplateQuery
+	HavingIn(slot string, expr Expression) TemplateQuery
+	ExprIn(slot string, expr Expression) TemplateQuery
+	Dialect(d Dialect) TemplateQuery
+}
+
+// tplSegment is part of parsed template, either literal text or {{tag}}
+type tplSegment struct {
+	text  string
+	isTag bool
+}
+
 type templateQuery struct {
 	selTpl      string
 	cntTpl      string
 	fm          FnMapField
 	fv          FieldValues
-	whereExprs  []Expression
-	havingExprs []Expression
+	dialect     Dialect
+	whereExprs  map[string][]Expression
+	havingExprs map[string][]Expression
+	exprs       map[string][]Expression
 	limit       int64
 	offset      int64
 	orderBy     Stringer
@@ -25,227 +48,378 @@ type templateQuery struct {
 }
 
 // NewTemplateQuery create query builder
-func NewTemplateQuery(selTpl, cntTpl string, fm FnMapField, fv FieldValues) Query {
+func NewTemplateQuery(selTpl, cntTpl string, fm FnMapField, fv FieldValues) TemplateQuery {
 	return &templateQuery{
-		selTpl: selTpl,
-		cntTpl: cntTpl,
-		fm:     fm,
-		fv:     fv,
-	}
-}
-
-func (q *templateQuery) join(cols ...Stringer) string {
-	var sb strings.Builder
-	if len(cols) == 0 {
-		sb.WriteString("*")
-	} else {
-		sb.WriteString(cols[0].String())
-		for idx := 1; idx < len(cols); idx++ {
-			sb.WriteByte(bComma)
-			sb.WriteString(cols[idx].String())
-		}
+		selTpl:      selTpl,
+		cntTpl:      cntTpl,
+		fm:          fm,
+		fv:          fv,
+		dialect:     Postgres,
+		whereExprs:  make(map[string][]Expression),
+		havingExprs: make(map[string][]Expression),
+		exprs:       make(map[string][]Expression),
 	}
-	return sb.String()
 }
 
-func (q *templateQuery) build(qTpl string, ph Placeholder, isCount bool, cols ...Stringer) (string, []interface{}, error) {
-	// BUILD SELECT
-
-	// store arguments
-	var args []interface{}
-
+// parseTemplate splits query template into literal texts and tags
+func parseTemplate(qTpl string) ([]tplSegment, error) {
 	// select template
 	query := strings.TrimSpace(qTpl)
 	// handle only SELECT or WITH query
 	if len(query) < 6 {
-		return "", nil, errors.New("query template too sort")
+		return nil, errors.New("query template too sort")
 	}
 	sSelect := query[:6]
 	sWith := query[:4]
 	if !strings.EqualFold(sSelect, tSelect) && !strings.EqualFold(sWith, tWith) {
-		return "", nil, errors.New("query must begin with SELECT/WITH")
+		return nil, errors.New("query must begin with SELECT/WITH")
 	}
 
-	// 1. replace {{field}} and {{field_value}}
-	for field, value := range q.fv {
-		tplField := "{{" + field + "}}"
-		if !strings.Contains(query, tplField) {
-			continue
+	var segs []tplSegment
+	for {
+		start := strings.Index(query, tOpen)
+		if start == -1 {
+			break
+		}
+		end := strings.Index(query[start+len(tOpen):], tClose)
+		if end == -1 {
+			return nil, errors.New("unterminated template tag at: " + query[start:])
+		}
+		end += start + len(tOpen)
+		tag := query[start+len(tOpen) : end]
+		switch name, slot := splitSlot(tag); name {
+		case tWhere, tHaving:
+			if strings.Contains(tag, tSlotSep) && slot == defaultSlot {
+				return nil, errors.New("empty slot name in template tag " + tOpen + tag + tClose)
+			}
+		case tExpr:
+			if slot == defaultSlot {
+				return nil, errors.New("template tag " + tOpen + tag + tClose + " requires slot name")
+			}
 		}
 
-		dbField, err := q.fm(field)
+		if start > 0 {
+			segs = append(segs, tplSegment{text: query[:start]})
+		}
+		segs = append(segs, tplSegment{text: tag, isTag: true})
+		query = query[end+len(tClose):]
+	}
+	if query != "" {
+		segs = append(segs, tplSegment{text: query})
+	}
+
+	return segs, nil
+}
+
+// splitSlot splits tag into name and slot, e.g. WHERE:inner -> WHERE, inner
+func splitSlot(tag string) (string, string) {
+	if idx := strings.Index(tag, tSlotSep); idx >= 0 {
+		return tag[:idx], tag[idx+len(tSlotSep):]
+	}
+	return tag, defaultSlot
+}
+
+func (q *templateQuery) build(qTpl string, ph Placeholder, isCount bool, cols ...Stringer) (string, []interface{}, error) {
+	segs, err := parseTemplate(qTpl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Every tag is rendered in order of appearance, so that each occurence
+	// gets its own placeholders and arguments.
+	var args []interface{}
+	sb := strings.Builder{}
+	rendered := make(map[string]bool)
+	hasLimit := false
+	for _, seg := range segs {
+		if seg.isTag && seg.text == tLimit {
+			hasLimit = !isCount && q.limit > 0
+		}
+	}
+	texts, err := q.emptyListTexts(segs)
+	if err != nil {
+		return "", nil, err
+	}
+	for i, seg := range segs {
+		if text, ok := texts[i]; ok {
+			// replaced by condition of empty list
+			sb.WriteString(text)
+			rendered[seg.text] = seg.isTag
+			continue
+		}
+		if !seg.isTag {
+			sb.WriteString(seg.text)
+			continue
+		}
+		varg, err := q.writeTag(&sb, ph, seg.text, isCount, hasLimit, cols...)
 		if err != nil {
 			return "", nil, err
 		}
+		args = append(args, varg...)
+		rendered[seg.text] = true
+	}
 
-		// construct place holder
-		tplFieldVal := "{{" + field + "_value}}"
-		var tplFieldValPh string
-
-		// check wether array or not
-		rt := reflect.TypeOf(value)
-		switch rt.Kind() {
-		case reflect.Slice, reflect.Array:
-			s := reflect.ValueOf(value)
-			if nelem := s.Len(); nelem > 0 {
-				v := s.Index(0)
-				if !v.CanInterface() {
-					return "", nil, errors.New("invalid field value")
-				}
-				args = append(args, v.Interface())
-
-				sb := strings.Builder{}
-				sb.WriteByte(bLParenthesis)
-				sb.WriteString(ph.Next())
-				for i := 1; i < nelem; i++ {
-					sb.WriteByte(bComma)
-					sb.WriteString(ph.Next())
-
-					v := s.Index(i)
-					if !v.CanInterface() {
-						return "", nil, errors.New("invalid field value")
-					}
-					args = append(args, v.Interface())
-				}
-				sb.WriteByte(bRParenthesis)
-
-				tplFieldValPh = sb.String()
-			}
+	// expression in named slot must not be silently dropped
+	if err := q.checkSlots(tWhere, q.whereExprs, rendered); err != nil {
+		return "", nil, err
+	}
+	if err := q.checkSlots(tHaving, q.havingExprs, rendered); err != nil {
+		return "", nil, err
+	}
+	if err := q.checkSlots(tExpr, q.exprs, rendered); err != nil {
+		return "", nil, err
+	}
 
-		default:
-			tplFieldValPh = ph.Next()
-			args = append(args, value)
+	if ph.Position() != len(args) {
+		return "", nil, errors.New("number of placeholder do not match arguments count")
+	}
+
+	return sb.String(), args, nil
+}
+
+// checkSlots ensure every named slot which has expressions exists in the template
+func (q *templateQuery) checkSlots(name string, slots map[string][]Expression, rendered map[string]bool) error {
+	for slot, exprs := range slots {
+		if slot == defaultSlot || len(exprs) == 0 {
+			continue
+		}
+		if tag := name + tSlotSep + slot; !rendered[tag] {
+			return errors.New("slot " + tOpen + tag + tClose + " not found in template")
 		}
+	}
+	return nil
+}
 
-		query = strings.ReplaceAll(query, tplField, dbField)
-		query = strings.ReplaceAll(query, tplFieldVal, tplFieldValPh)
+// writeTag writes content of single template tag
+func (q *templateQuery) writeTag(sb StringBuilder, ph Placeholder, tag string, isCount, hasLimit bool, cols ...Stringer) ([]interface{}, error) {
+	name, slot := splitSlot(tag)
+	switch name {
+	case tColumns:
+		return writeColumns(sb, ph, cols)
+	case tWhere:
+		return writeConditions(sb, ph, " WHERE ", q.whereExprs[slot])
+	case tHaving:
+		return writeConditions(sb, ph, " HAVING ", q.havingExprs[slot])
+	case tExpr:
+		return q.writeExpr(sb, ph, slot)
+	case tGroupBy:
+		if !isEmptyStringer(q.groupBy) {
+			sb.WriteString(" GROUP BY ")
+			args, err := writeStringer(sb, ph, q.groupBy)
+			sb.WriteByte(bSpace)
+			return args, err
+		}
+	case tOrderBy:
+		// ORDER BY, limit and offset are omitted in count(*)
+		if !isCount && !isEmptyStringer(q.orderBy) {
+			sb.WriteString(" ORDER BY ")
+			args, err := writeStringer(sb, ph, q.orderBy)
+			sb.WriteByte(bSpace)
+			return args, err
+		}
+	case tLimit:
+		if !isCount && q.limit > 0 {
+			q.dialect.WriteLimit(sb, q.limit)
+		}
+	case tOffset:
+		if !isCount && q.offset > 0 {
+			q.dialect.WriteOffset(sb, q.offset, hasLimit)
+		}
+	default:
+		return q.writeFieldValue(sb, ph, tag)
 	}
+	return nil, nil
+}
 
-	// relace {{columns}}
-	strCols := q.join(cols...)
-	query = strings.ReplaceAll(query, tColumns, strCols)
+// writeExpr writes expressions of {{EXPR:slot}} joined with AND.
+// Slot without expression is rendered as always true condition.
+func (q *templateQuery) writeExpr(sb StringBuilder, ph Placeholder, slot string) ([]interface{}, error) {
+	n := sb.Len()
+	args, err := writeConditions(sb, ph, "", q.exprs[slot])
+	if err == nil && sb.Len() == n {
+		sb.WriteString("(1=1)")
+	}
+	return args, err
+}
 
-	// replace where
-	if nexp := len(q.whereExprs); nexp > 0 {
-		sb := strings.Builder{}
-		addWhere := true
-		for idx, e := range q.whereExprs {
-			if e.IsEmpty() {
-				continue
-			}
-			if addWhere {
-				addWhere = false
-				sb.WriteString(" WHERE ")
-			}
-			if idx > 0 {
-				sb.WriteString(" AND ")
-			}
+// writeFieldValue replace {{field}} and {{field_value}}.
+// Unknown tag is written as it is.
+func (q *templateQuery) writeFieldValue(sb StringBuilder, ph Placeholder, tag string) ([]interface{}, error) {
+	if _, ok := q.fv[tag]; ok {
+		dbField, err := q.fm(tag)
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString(dbField)
+		return nil, nil
+	}
 
-			if nexp > 1 {
-				sb.WriteByte(bLParenthesis)
-			}
-			varg, err := e.Build(&sb, ph)
-			if err != nil {
-				return "", nil, err
-			}
-			if nexp > 1 {
-				sb.WriteByte(bRParenthesis)
+	field := strings.TrimSuffix(tag, tValue)
+	value, ok := q.fv[field]
+	if !ok || field == tag {
+		sb.WriteString(tOpen)
+		sb.WriteString(tag)
+		sb.WriteString(tClose)
+		return nil, nil
+	}
+
+	// check wether array or not
+	s := reflect.ValueOf(value)
+	switch s.Kind() {
+	case reflect.Slice, reflect.Array:
+		if _, isBytes := value.([]byte); isBytes {
+			break
+		}
+		nelem := s.Len()
+		args := make([]interface{}, nelem)
+		for i := 0; i < nelem; i++ {
+			v := s.Index(i)
+			if !v.CanInterface() {
+				return nil, errors.New("invalid field value")
 			}
-			args = append(args, varg...)
+			args[i] = v.Interface()
 		}
+		q.dialect.WriteList(sb, ph, nelem)
+		return args, nil
+	}
 
-		// replace where
-		query = strings.ReplaceAll(query, tWhere, sb.String())
-	} else {
-		query = strings.ReplaceAll(query, tWhere, "")
-	}
-
-	// Add group by if not SELECT COUNT(*)
-	if q.groupBy != nil {
-		sb := strings.Builder{}
-		sb.WriteString(" GROUP BY ")
-		sb.WriteString(q.groupBy.String())
-		sb.WriteByte(bSpace)
-		query = strings.ReplaceAll(query, tGroupBy, sb.String())
-	} else {
-		query = strings.ReplaceAll(query, tGroupBy, "")
-	}
-
-	// process HAVING clause
-	if nexp := len(q.havingExprs); nexp > 0 {
-		addHaving := true
-		sb := strings.Builder{}
-		for idx, e := range q.havingExprs {
-			if e.IsEmpty() {
-				continue
-			}
-			if addHaving {
-				addHaving = false
-				sb.WriteString(" HAVING ")
-			}
-			if idx > 0 {
-				sb.WriteString(" AND ")
-			}
+	sb.WriteString(ph.Next())
+	return []interface{}{value}, nil
+}
 
-			if nexp > 1 {
-				sb.WriteByte(bLParenthesis)
-			}
-			varg, err := e.Build(&sb, ph)
-			if err != nil {
-				return "", nil, err
-			}
-			if nexp > 1 {
-				sb.WriteByte(bRParenthesis)
-			}
-			args = append(args, varg...)
+// emptyListTexts return replacement text of template segments, indexed by position,
+// for `operand IN {{field_value}}` where value of the field is empty list. Same as filter tree,
+// IN () never matches and NOT IN () always matches, i.e. the whole condition is replaced
+// by (1=0) or (1=1). Operand is either a {{field}} tag or an expression at the end of the text,
+// e.g. t.code, LOWER(name) or t.col::text.
+func (q *templateQuery) emptyListTexts(segs []tplSegment) (map[int]string, error) {
+	var texts map[int]string
+	for i, seg := range segs {
+		if !seg.isTag || !q.isEmptyList(seg.text) || i == 0 || segs[i-1].isTag {
+			continue
 		}
-		query = strings.ReplaceAll(query, tHaving, sb.String())
-	} else {
-		query = strings.ReplaceAll(query, tHaving, "")
-	}
-
-	// ADD ORDER BY, limit and offset if not count(*)
-	if isCount {
-		query = strings.ReplaceAll(query, tOrderBy, "")
-		query = strings.ReplaceAll(query, tLimit, "")
-		query = strings.ReplaceAll(query, tOffset, "")
-	} else {
-		if q.orderBy != nil {
-			sb := strings.Builder{}
-			sb.WriteString(" ORDER BY ")
-			sb.WriteString(q.orderBy.String())
-			sb.WriteByte(bSpace)
-			query = strings.ReplaceAll(query, tOrderBy, sb.String())
-		} else {
-			query = strings.ReplaceAll(query, tOrderBy, "")
+		text := segs[i-1].text
+		loc := reInKeyword.FindStringSubmatchIndex(text)
+		if loc == nil {
+			// not an IN operand, the list is written by the dialect
+			continue
+		}
+		cond := "(1=0)"
+		if loc[2] >= 0 {
+			cond = "(1=1)"
+		}
+		if texts == nil {
+			texts = make(map[int]string)
 		}
 
-		if q.limit > 0 {
-			sb := strings.Builder{}
-			sb.WriteString(" LIMIT ")
-			sb.WriteString(strconv.FormatInt(q.limit, 10))
-			sb.WriteByte(bSpace)
-			query = strings.ReplaceAll(query, tLimit, sb.String())
-		} else {
-			query = strings.ReplaceAll(query, tLimit, "")
+		prefix := text[:loc[0]]
+		if strings.TrimSpace(prefix) == "" && i >= 2 && segs[i-2].isTag {
+			// operand is field tag, e.g. {{code}} IN {{code_value}}
+			texts[i-2] = ""
+			texts[i-1] = cond
+			texts[i] = ""
+			continue
 		}
+		start := inOperandStart(prefix)
+		if start < 0 {
+			return nil, errors.New("operand of empty list " + tOpen + seg.text + tClose + " not found")
+		}
+		texts[i-1] = prefix[:start] + cond
+		texts[i] = ""
+	}
+	return texts, nil
+}
 
-		if q.offset > 0 {
-			sb := strings.Builder{}
-			sb.WriteString(" OFFSET ")
-			sb.WriteString(strconv.FormatInt(q.offset, 10))
-			sb.WriteByte(bSpace)
-			query = strings.ReplaceAll(query, tOffset, sb.String())
-		} else {
-			query = strings.ReplaceAll(query, tOffset, "")
+// inOperandStart return start of the operand at the end of text, or -1 if it is not found.
+// Operand is identifier, quoted identifier or function call, joined by . or ::
+func inOperandStart(text string) int {
+	i := len(strings.TrimRight(text, " \t\r\n"))
+	for {
+		start := operandPartStart(text, i)
+		if start < 0 {
+			return -1
+		}
+		i = start
+		switch {
+		case i > 0 && text[i-1] == '.':
+			i--
+		case i > 1 && text[i-2:i] == "::":
+			i -= 2
+		default:
+			// operand must not be right side of other operator, e.g. a + b IN (...)
+			before := strings.TrimRight(text[:i], " \t\r\n")
+			if before != "" && strings.ContainsRune("+-*/%|&^~<>=!", rune(before[len(before)-1])) {
+				return -1
+			}
+			// keyword is not an operand, e.g. WHERE NOT IN (...)
+			switch strings.ToUpper(strings.TrimSpace(text[i:])) {
+			case "WHERE", "AND", "OR", "NOT", "ON", "HAVING", "WHEN", "THEN", "ELSE":
+				return -1
+			}
+			return i
 		}
 	}
+}
 
-	if ph.Position() != len(args) {
-		return "", nil, errors.New("number of placeholder do not match arguments count")
+// operandPartStart return start of identifier, quoted identifier or function call ending at end
+func operandPartStart(text string, end int) int {
+	if end == 0 {
+		return -1
+	}
+	isIdent := func(c byte) bool {
+		return c == '_' || c == '$' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
 	}
+	start := end
+	switch c := text[end-1]; c {
+	case ')':
+		// find matching opening parenthesis
+		depth := 0
+		for start = end - 1; start >= 0; start-- {
+			switch text[start] {
+			case ')':
+				depth++
+			case '(':
+				depth--
+			}
+			if depth == 0 {
+				break
+			}
+		}
+		if start < 0 {
+			return -1
+		}
+	case '"', '`', '\'':
+		start = strings.LastIndexByte(text[:end-1], c)
+		return start
+	case ']':
+		return strings.LastIndexByte(text[:end-1], '[')
+	}
+	// identifier or name of the function
+	for start > 0 && isIdent(text[start-1]) {
+		start--
+	}
+	if start == end {
+		return -1
+	}
+	return start
+}
 
-	return query, args, nil
+// isEmptyList return true if tag is value of field whose value is empty list
+func (q *templateQuery) isEmptyList(tag string) bool {
+	field := strings.TrimSuffix(tag, tValue)
+	value, ok := q.fv[field]
+	if !ok || field == tag {
+		return false
+	}
+	if _, isBytes := value.([]byte); isBytes {
+		return false
+	}
+	s := reflect.ValueOf(value)
+	switch s.Kind() {
+	case reflect.Slice, reflect.Array:
+		return s.Len() == 0
+	}
+	return false
 }
 
 func (q *templateQuery) IsEmpty() bool {
@@ -266,11 +440,34 @@ func (q *templateQuery) From(name Stringer) Query {
 }
 
 func (q *templateQuery) Where(expr Expression) Query {
-	q.whereExprs = append(q.whereExprs, expr)
-	return q
+	return q.WhereIn(defaultSlot, expr)
 }
 func (q *templateQuery) Having(expr Expression) Query {
-	q.havingExprs = append(q.havingExprs, expr)
+	return q.HavingIn(defaultSlot, expr)
+}
+
+// ExprIn adds expression to named {{EXPR:slot}} of the template
+func (q *templateQuery) ExprIn(slot string, expr Expression) TemplateQuery {
+	q.exprs[slot] = append(q.exprs[slot], expr)
+	return q
+}
+
+// Dialect set database dialect used for placeholder, list expansion and LIMIT/OFFSET.
+// Default dialect is Postgres.
+func (q *templateQuery) Dialect(d Dialect) TemplateQuery {
+	q.dialect = d
+	return q
+}
+
+// WhereIn adds expression to named {{WHERE:slot}} of the template
+func (q *templateQuery) WhereIn(slot string, expr Expression) TemplateQuery {
+	q.whereExprs[slot] = append(q.whereExprs[slot], expr)
+	return q
+}
+
+// HavingIn adds expression to named {{HAVING:slot}} of the template
+func (q *templateQuery) HavingIn(slot string, expr Expression) TemplateQuery {
+	q.havingExprs[slot] = append(q.havingExprs[slot], expr)
 	return q
 }
 func (q *templateQuery) Columns(cols ...Stringer) Query {
@@ -317,7 +514,7 @@ func (q *templateQuery) Select(cols ...Stringer) (string, []interface{}, error)
 	if len(cols) != 0 {
 		selectCols = cols
 	}
-	ph := NewPsqlPlaceholder()
+	ph := q.dialect.Placeholder()
 	query, args, err := q.build(q.selTpl, ph, false, selectCols...)
 	if err != nil {
 		return "", nil, err
@@ -326,7 +523,7 @@ func (q *templateQuery) Select(cols ...Stringer) (string, []interface{}, error)
 }
 
 func (q *templateQuery) Count() (string, []interface{}, error) {
-	ph := NewPsqlPlaceholder()
+	ph := q.dialect.Placeholder()
 	qTpl := q.cntTpl
 	if len(qTpl) == 0 {
 		qTpl = q.selTpl
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
 )
 
 func buildQuery(b *testing.B, i int) {
@@ -161,3 +162,146 @@ func TestTemplateQuery(t *testing.T) {
 	t.Log("COUNT:", strCount)
 	t.Log("ARGS:", args)
 }
+
+func TestTemplateQuerySlots(t *testing.T) {
+	tpl := `
+		WITH recent AS (
+			SELECT id FROM orders {{WHERE:inner}}
+		)
+		SELECT {{COLUMNS}} FROM country AS tc
+		JOIN recent ON recent.id = tc.order_id
+		{{WHERE}} {{GROUPBY}} {{HAVING:outer}}`
+
+	exp := qy.NewExpressionBuilder()
+	qTpl := qy.NewTemplateQuery(tpl, "", nil, nil).
+		WhereIn("inner", exp.Gt(qy.F("total"), 100)).
+		HavingIn("outer", exp.Gt(qy.R("COUNT(*)"), 2))
+	qTpl.Where(exp.Eq(qy.F("code"), "ID")).
+		GroupBy(qy.F("code"))
+
+	query, args, err := qTpl.Select(qy.F("code"))
+	assert.NoError(t, err)
+	assert.Contains(t, query, `SELECT id FROM orders  WHERE ("total" > $1)`)
+	assert.Contains(t, query, `WHERE ("code" = $2)`)
+	assert.Contains(t, query, `HAVING (COUNT(*) > $3)`)
+	assert.Equal(t, []interface{}{100, "ID", 2}, args)
+
+	// the same slot rendered twice gets its own arguments
+	qTpl = qy.NewTemplateQuery("SELECT * FROM a {{WHERE}} UNION SELECT * FROM b {{WHERE}}", "", nil, nil)
+	qTpl.Where(exp.Eq(qy.F("id"), 1))
+	query, args, err = qTpl.Select()
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM a  WHERE ("id" = $1) UNION SELECT * FROM b  WHERE ("id" = $2)`, query)
+	assert.Equal(t, []interface{}{1, 1}, args)
+
+	// named slot which is not in template
+	qTpl = qy.NewTemplateQuery("SELECT * FROM a {{WHERE}}", "", nil, nil).
+		WhereIn("inner", exp.Eq(qy.F("id"), 1))
+	_, _, err = qTpl.Select()
+	assert.Error(t, err)
+}
+
+func TestTemplateQueryDialect(t *testing.T) {
+	tpl := "SELECT {{COLUMNS}} FROM country {{WHERE}} AND {{code}} IN {{code_value}} {{LIMIT}} {{OFFSET}}"
+	fm := func(field string) (string, error) {
+		return field, nil
+	}
+	fv := qy.FieldValues{"code": []string{"ID", "SG"}}
+	exp := qy.NewExpressionBuilder()
+
+	tests := []struct {
+		dialect qy.Dialect
+		query   string
+	}{
+		{qy.Postgres, `SELECT * FROM country  WHERE ("name" = $1) AND code IN ($2,$3)   OFFSET 20 `},
+		{qy.MySQL, "SELECT * FROM country  WHERE (`name` = ?) AND code IN (?,?)   LIMIT 18446744073709551615 OFFSET 20 "},
+		{qy.SQLite, "SELECT * FROM country  WHERE (\"name\" = ?) AND code IN (?,?)   LIMIT -1 OFFSET 20 "},
+	}
+	for _, test := range tests {
+		qTpl := qy.NewTemplateQuery(tpl, "", fm, fv).Dialect(test.dialect)
+		qTpl.Where(exp.Eq(qy.F("name"), "Indonesia")).Offset(20)
+		query, args, err := qTpl.Select()
+		assert.NoError(t, err, test.dialect.Name())
+		assert.Equal(t, test.query, query, test.dialect.Name())
+		assert.Equal(t, []interface{}{"Indonesia", "ID", "SG"}, args, test.dialect.Name())
+	}
+
+	// empty list never matches with IN and always matches with NOT IN
+	emptyTpl := "SELECT * FROM country WHERE {{code}} IN {{code_value}} {{LIMIT}}"
+	qTpl := qy.NewTemplateQuery(emptyTpl, "", fm, qy.FieldValues{"code": []string{}}).Dialect(qy.MySQL)
+	query, args, err := qTpl.Limit(5).Select()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM country WHERE (1=0)  LIMIT 5 ", query)
+	assert.Empty(t, args)
+
+	emptyFv := qy.FieldValues{"code": []string{}, "id": []int{}, "name": []string{"A"}}
+	emptyTests := map[string]string{
+		"SELECT * FROM country WHERE c.code NOT IN {{code_value}} AND id in {{id_value}}":           "SELECT * FROM country WHERE (1=1) AND (1=0)",
+		"SELECT * FROM country WHERE LOWER(c.code) NOT IN {{code_value}} OR x = 1":                  "SELECT * FROM country WHERE (1=1) OR x = 1",
+		"SELECT * FROM country WHERE (t.col::text IN {{code_value}})":                               "SELECT * FROM country WHERE ((1=0))",
+		"SELECT * FROM country WHERE \"t\".\"code\" NOT IN {{id_value}} AND name IN {{name_value}}": "SELECT * FROM country WHERE (1=1) AND name IN ($1)",
+		"SELECT * FROM country WHERE COALESCE(a, lower(b)) IN {{code_value}}":                       "SELECT * FROM country WHERE (1=0)",
+	}
+	for tpl, expected := range emptyTests {
+		query, _, err = qy.NewTemplateQuery(tpl, "", fm, emptyFv).Select()
+		assert.NoError(t, err, tpl)
+		assert.Equal(t, expected, query, tpl)
+	}
+
+	// operand which can not be replaced is an error, instead of NOT IN (NULL)
+	for _, tpl := range []string{
+		"SELECT * FROM country WHERE a + b NOT IN {{code_value}}",
+		"SELECT * FROM country WHERE NOT IN {{code_value}}",
+	} {
+		_, _, err = qy.NewTemplateQuery(tpl, "", fm, emptyFv).Select()
+		assert.Error(t, err, tpl)
+	}
+
+	// tree without dialect follows dialect of the template query
+	tree, err := qy.NewTree(nil).Parse([]byte(`{"name": {"$like": "a%"}}`))
+	if assert.NoError(t, err) {
+		query, args, err = qy.NewTemplateQuery("SELECT * FROM country {{WHERE}}", "", nil, nil).
+			Dialect(qy.MySQL).Where(tree).Select()
+		assert.NoError(t, err)
+		assert.Equal(t, `SELECT * FROM country  WHERE (name LIKE ? ESCAPE '\\')`, query)
+		assert.Equal(t, []interface{}{"a%"}, args)
+	}
+	tree, err = qy.NewTree(nil).Parse([]byte(`{"name": {"$isDistinctFrom": "a"}, "code": {"$isNotDistinctFrom": null}}`))
+	if assert.NoError(t, err) {
+		query, args, err = qy.NewTemplateQuery("SELECT * FROM country {{WHERE}}", "", nil, nil).
+			Dialect(qy.MySQL).Where(tree).Select()
+		assert.NoError(t, err)
+		assert.Equal(t, `SELECT * FROM country  WHERE ((NOT (name <=> ?)) AND ((code <=> NULL)))`, query)
+		assert.Equal(t, []interface{}{"a"}, args)
+	}
+
+	// identifier is quoted by dialect
+	assert.Equal(t, `"t"."a""b"`, qy.Postgres.QuoteIdent(`t.a"b`))
+	assert.Equal(t, "`t`.`a``b`", qy.MySQL.QuoteIdent("t.a`b"))
+	assert.Equal(t, `"name"`, qy.SQLite.QuoteIdent("name"))
+}
+
+func TestTemplateQueryExpr(t *testing.T) {
+	tpl := `
+		SELECT {{COLUMNS}} FROM orders
+		WHERE {{EXPR:dateRange}} AND customer_id IN (
+			SELECT id FROM customer WHERE {{EXPR:customer}}
+		) AND {{EXPR:unused}}`
+
+	exp := qy.NewExpressionBuilder()
+	qTpl := qy.NewTemplateQuery(tpl, "", nil, nil).
+		ExprIn("dateRange", exp.Between(qy.F("created_at"), "2021-01-01", "2021-12-31")).
+		ExprIn("customer", exp.ILike(qy.F("name"), "%putu%")).
+		ExprIn("customer", exp.Null(qy.F("deleted_at")))
+
+	query, args, err := qTpl.Select()
+	assert.NoError(t, err)
+	assert.Contains(t, query, `WHERE ("created_at" BETWEEN $1 AND $2) AND customer_id IN`)
+	assert.Contains(t, query, `WHERE (("name" ILIKE $3)) AND (("deleted_at" IS NULL))`)
+	assert.Contains(t, query, `AND (1=1)`)
+	assert.Equal(t, []interface{}{"2021-01-01", "2021-12-31", "%putu%"}, args)
+
+	// slot name is required
+	_, _, err = qy.NewTemplateQuery("SELECT * FROM a WHERE {{EXPR}}", "", nil, nil).Select()
+	assert.Error(t, err)
+}
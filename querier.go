@@ -2,6 +2,9 @@ package squery
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"strconv"
 
 	logger "github.com/ipsusila/slog"
 	"github.com/jmoiron/sqlx"
@@ -17,6 +20,25 @@ type Error interface {
 	Err() error
 }
 
+// ExecResult is result of INSERT/UPDATE/DELETE statement
+type ExecResult struct {
+	RowsAffected int64
+	LastInsertID int64 // zero if not supported by the driver, e.g. postgres
+}
+
+// RowsAffectedError is returned by Exec when number of affected rows
+// does not match the expectation set by MustAffect
+type RowsAffectedError struct {
+	Expected int64
+	Actual   int64
+}
+
+// Error interface
+func (e *RowsAffectedError) Error() string {
+	return "expected " + strconv.FormatInt(e.Expected, 10) +
+		" affected rows, got " + strconv.FormatInt(e.Actual, 10)
+}
+
 // Querier execute query
 type Querier interface {
 	Error
@@ -25,6 +47,10 @@ type Querier interface {
 	Many(ctx context.Context, dest interface{}) error
 	ManyMap(ctx context.Context, fm FieldMapSelector) (MapSlice, error)
 	Count(ctx context.Context) (int64, error)
+	Exec(ctx context.Context) (ExecResult, error)
+	MustAffect(n int64) Querier
+	Rows(ctx context.Context) (Rows, error)
+	Each(ctx context.Context, fn func(Row) error) error
 }
 
 // QuerierConstructor is interface for building various querier
@@ -34,6 +60,7 @@ type QuerierConstructor interface {
 	InQuery(query string, args []interface{}, logFields ...interface{}) Querier
 	RebindQuery(query string, args []interface{}, logFields ...interface{}) Querier
 	WithSelector(s Selector, logFields ...interface{}) Querier
+	Tx(ctx context.Context, opts *sql.TxOptions, fn func(QuerierConstructor) error) error
 }
 
 // sql string querier
@@ -43,6 +70,7 @@ type querier struct {
 	query     string
 	args      []interface{}
 	err       error
+	affect    *int64
 }
 
 // select selector querier
@@ -51,13 +79,42 @@ type sbQuerier struct {
 	selector Selector
 }
 
+// DB is database handle used by querier, it is satisfied by *sqlx.DB, *sqlx.Tx and *sqlx.Conn
+type DB interface {
+	Rebind(query string) string
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+	QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Ensure sqlx handles implement DB interface
+var (
+	_ DB = (*sqlx.DB)(nil)
+	_ DB = (*sqlx.Tx)(nil)
+	_ DB = (*sqlx.Conn)(nil)
+)
+
+// namedBinder is implemented by *sqlx.DB and *sqlx.Tx
+type namedBinder interface {
+	BindNamed(query string, arg interface{}) (string, []interface{}, error)
+}
+
 type querierConstructor struct {
-	db  *sqlx.DB
-	log logger.Logger
+	db    DB
+	log   logger.Logger
+	tx    *sqlx.Tx // active transaction
+	level int      // nesting level of transaction, i.e. savepoint
 }
 
-func NewQuerierConstructor(db *sqlx.DB, log logger.Logger) QuerierConstructor {
-	return &querierConstructor{db: db, log: log}
+// NewQuerierConstructor creates querier constructor, db is *sqlx.DB, *sqlx.Tx or *sqlx.Conn
+func NewQuerierConstructor(db DB, log logger.Logger) QuerierConstructor {
+	qc := &querierConstructor{db: db, log: log}
+	if tx, ok := db.(*sqlx.Tx); ok {
+		qc.tx, qc.level = tx, 1
+	}
+	return qc
 }
 
 // NamedQuery assign any query with named place holder e.g. id = :id, city = :city to querier.
@@ -81,8 +138,15 @@ func (c *querierConstructor) NamedQuery(query string, arg interface{}, hasIn boo
 			q.query = query
 			q.args = args
 		}
+	} else if b, ok := c.db.(namedBinder); ok {
+		q.query, q.args, q.err = b.BindNamed(query, arg)
 	} else {
-		q.query, q.args, q.err = c.db.BindNamed(query, arg)
+		// *sqlx.Conn does not bind named query
+		query, args, err := sqlx.Named(query, arg)
+		if q.err = err; q.err == nil {
+			q.query = c.db.Rebind(query)
+			q.args = args
+		}
 	}
 	return &q
 }
@@ -230,6 +294,36 @@ func (q *querier) Count(ctx context.Context) (int64, error) {
 	return count, q.err
 }
 
+// MustAffect sets the number of rows which must be affected by Exec,
+// otherwise Exec returns RowsAffectedError
+func (q *querier) MustAffect(n int64) Querier {
+	q.affect = &n
+	return q
+}
+
+// Exec executes INSERT/UPDATE/DELETE statement
+func (q *querier) Exec(ctx context.Context) (ExecResult, error) {
+	q.logIfDebug("exec statement")
+	var result ExecResult
+	if q.err == nil {
+		var res sql.Result
+		res, q.err = q.c.db.ExecContext(ctx, q.query, q.args...)
+		if q.err == nil {
+			result.RowsAffected, q.err = res.RowsAffected()
+			// last insert id is not supported by all drivers
+			if id, err := res.LastInsertId(); err == nil {
+				result.LastInsertID = id
+			}
+		}
+		if q.err == nil && q.affect != nil && *q.affect != result.RowsAffected {
+			q.err = &RowsAffectedError{Expected: *q.affect, Actual: result.RowsAffected}
+		}
+	}
+
+	q.logIfError("exec statement error")
+	return result, q.err
+}
+
 // Err return first error encountered during processing.
 // If error encountered, further processing will stop
 func (q *querier) Err() error {
@@ -281,3 +375,17 @@ func (q *sbQuerier) Count(ctx context.Context) (int64, error) {
 	q.query, q.args, q.err = q.selector.Count()
 	return q.querier.Count(ctx)
 }
+
+// MustAffect sets the number of rows which must be affected by Exec
+func (q *sbQuerier) MustAffect(n int64) Querier {
+	q.querier.MustAffect(n)
+	return q
+}
+
+// Exec is not supported, selector only builds SELECT statement
+func (q *sbQuerier) Exec(ctx context.Context) (ExecResult, error) {
+	if q.err == nil {
+		q.err = errors.New("Exec is not supported by selector querier")
+	}
+	return q.querier.Exec(ctx)
+}
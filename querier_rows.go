@@ -0,0 +1,164 @@
+package squery
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Row is current record of the result set
+type Row interface {
+	// Scan copies columns into struct (by db tag) or into primitive types
+	Scan(dest ...interface{}) error
+	// Map returns columns as map, field is converted using fm if it is not nil
+	Map(fm FieldMapSelector) (map[string]interface{}, error)
+}
+
+// Rows iterates the result set without loading all records into memory.
+// Rows must be closed, it is closed automatically when Next returns false.
+type Rows interface {
+	Row
+	Next() bool
+	Err() error
+	Close() error
+}
+
+// rows iterator of querier
+type rows struct {
+	q      *querier
+	rows   *sqlx.Rows
+	closed bool
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Next prepares next record, rows is closed when there is no more record
+func (r *rows) Next() bool {
+	if r.closed {
+		return false
+	}
+	if r.rows.Next() {
+		return true
+	}
+	r.Close()
+	return false
+}
+
+// Scan copies columns of the current record. Single pointer to struct
+// is scanned by column name, otherwise columns are scanned in order.
+func (r *rows) Scan(dest ...interface{}) error {
+	var err error
+	if len(dest) == 1 && isStructDest(dest[0]) {
+		err = r.rows.StructScan(dest[0])
+	} else {
+		err = r.rows.Scan(dest...)
+	}
+	return r.keepErr(err, "scan record error")
+}
+
+// Map returns columns of the current record
+func (r *rows) Map(fm FieldMapSelector) (map[string]interface{}, error) {
+	dest := make(map[string]interface{})
+	if err := r.rows.MapScan(dest); err != nil {
+		return nil, r.keepErr(err, "map record error")
+	}
+	if fm != nil {
+		dest = r.q.execMapper(dest, fm)
+	}
+	return dest, nil
+}
+
+// Err return error encountered during iteration, including error of Scan and Map
+func (r *rows) Err() error {
+	if r.q.err != nil {
+		return r.q.err
+	}
+	return r.rows.Err()
+}
+
+// keepErr stores the first error in querier, so that it is reported by Err
+func (r *rows) keepErr(err error, msg string) error {
+	if err != nil && r.q.err == nil {
+		r.q.err = err
+		r.q.logIfError(msg)
+	}
+	return err
+}
+
+// Close closes the rows, error of the iteration is kept in querier
+func (r *rows) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	err := r.rows.Close()
+	if q := r.q; q.err == nil {
+		if q.err = r.rows.Err(); q.err == nil {
+			q.err = err
+		}
+		q.logIfError("iterate records error")
+	}
+	return err
+}
+
+// isStructDest return true if dest is pointer to struct which is not scanned as single value
+func isStructDest(dest interface{}) bool {
+	if _, ok := dest.(sql.Scanner); ok {
+		return false
+	}
+	t := reflect.TypeOf(dest)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return false
+	}
+	t = t.Elem()
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+// Rows executes the query and return iterator of the records.
+// The iterator must be closed after use.
+func (q *querier) Rows(ctx context.Context) (Rows, error) {
+	q.logIfDebug("iterate records")
+	var r *sqlx.Rows
+	if q.err == nil {
+		r, q.err = q.c.db.QueryxContext(ctx, q.query, q.args...)
+	}
+	q.logIfError("iterate records error")
+	if q.err != nil {
+		return nil, q.err
+	}
+	return &rows{q: q, rows: r}, nil
+}
+
+// Each calls fn for every record. Iteration stops when fn returns error,
+// which is then returned by Each. Rows are always closed.
+func (q *querier) Each(ctx context.Context, fn func(Row) error) error {
+	it, err := q.Rows(ctx)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for it.Next() {
+		if err := fn(it); err != nil {
+			q.err = err
+			q.logIfError("iterate records callback error")
+			return err
+		}
+	}
+	return q.err
+}
+
+// Rows executes the query and return iterator of the records.
+func (q *sbQuerier) Rows(ctx context.Context) (Rows, error) {
+	q.query, q.args, q.err = q.selector.Select()
+	return q.querier.Rows(ctx)
+}
+
+// Each calls fn for every record.
+func (q *sbQuerier) Each(ctx context.Context, fn func(Row) error) error {
+	q.query, q.args, q.err = q.selector.Select()
+	return q.querier.Each(ctx, fn)
+}
@@ -0,0 +1,177 @@
+package squery_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+type rowsRecord struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func newRowsDB() *fakeDB {
+	return &fakeDB{
+		columns: []string{"id", "name"},
+		values:  [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}},
+	}
+}
+
+func TestQuerierEach(t *testing.T) {
+	ctx := context.Background()
+
+	// every record is scanned, rows is closed at the end
+	fdb := newRowsDB()
+	qc := newFakeQuerierConstructor(t, fdb)
+	var records []rowsRecord
+	err := qc.Query("SELECT id, name FROM t", nil).Each(ctx, func(row qy.Row) error {
+		var rec rowsRecord
+		if err := row.Scan(&rec); err != nil {
+			return err
+		}
+		records = append(records, rec)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []rowsRecord{{1, "a"}, {2, "b"}, {3, "c"}}, records)
+	assert.Equal(t, 1, fdb.opened)
+	assert.Equal(t, 1, fdb.closed)
+
+	// iteration stops at the first error of the callback
+	fdb = newRowsDB()
+	qc = newFakeQuerierConstructor(t, fdb)
+	errStop := errors.New("stop")
+	calls := 0
+	q := qc.Query("SELECT id, name FROM t", nil)
+	err = q.Each(ctx, func(row qy.Row) error {
+		calls++
+		if calls == 2 {
+			return errStop
+		}
+		return nil
+	})
+	assert.Equal(t, errStop, err)
+	assert.Equal(t, errStop, q.Err())
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 1, fdb.closed)
+
+	// scan error reaches the caller, also when it is ignored by the callback
+	fdb = newRowsDB()
+	qc = newFakeQuerierConstructor(t, fdb)
+	err = qc.Query("SELECT id, name FROM t", nil).Each(ctx, func(row qy.Row) error {
+		var id, name int64
+		return row.Scan(&id, &name)
+	})
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "converting"), err.Error())
+	}
+	assert.Equal(t, 1, fdb.closed)
+	q = qc.Query("SELECT id, name FROM t", nil)
+	err = q.Each(ctx, func(row qy.Row) error {
+		var id, name int64
+		_ = row.Scan(&id, &name)
+		return nil
+	})
+	assert.Error(t, err)
+	if assert.Error(t, q.Err()) {
+		assert.True(t, strings.Contains(q.Err().Error(), "converting"), q.Err().Error())
+	}
+
+	// error of iteration is returned after the last record
+	fdb = newRowsDB()
+	fdb.rowsErr = errors.New("connection lost")
+	qc = newFakeQuerierConstructor(t, fdb)
+	calls = 0
+	err = qc.Query("SELECT id, name FROM t", nil).Each(ctx, func(row qy.Row) error {
+		calls++
+		return nil
+	})
+	assert.EqualError(t, err, "connection lost")
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 1, fdb.closed)
+
+	// error of the query, no rows is opened
+	fdb = newRowsDB()
+	fdb.errs = map[string]error{"SELECT id, name FROM t": errors.New("query failed")}
+	qc = newFakeQuerierConstructor(t, fdb)
+	err = qc.Query("SELECT id, name FROM t", nil).Each(ctx, func(row qy.Row) error {
+		return errors.New("not called")
+	})
+	assert.EqualError(t, err, "query failed")
+	assert.Equal(t, 0, fdb.opened)
+
+	// selector querier
+	fdb = newRowsDB()
+	qc = newFakeQuerierConstructor(t, fdb)
+	calls = 0
+	err = qc.WithSelector(fakeSelector{}).Each(ctx, func(row qy.Row) error {
+		calls++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []string{"SELECT id FROM t"}, fdb.executed())
+}
+
+func TestQuerierRows(t *testing.T) {
+	ctx := context.Background()
+	fdb := newRowsDB()
+	qc := newFakeQuerierConstructor(t, fdb)
+
+	rows, err := qc.Query("SELECT id, name FROM t", nil).Rows(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	fm := func(field string, val interface{}) (string, interface{}, bool) {
+		return strings.ToUpper(field), val, true
+	}
+	if assert.True(t, rows.Next()) {
+		m, err := rows.Map(fm)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"ID": int64(1), "NAME": "a"}, m)
+	}
+
+	// closing early, rows is closed only once
+	assert.NoError(t, rows.Close())
+	assert.NoError(t, rows.Close())
+	assert.False(t, rows.Next())
+	assert.NoError(t, rows.Err())
+	assert.Equal(t, 1, fdb.closed)
+
+	// scan error is reported by Err
+	fdb = newRowsDB()
+	qc = newFakeQuerierConstructor(t, fdb)
+	rows, err = qc.Query("SELECT id, name FROM t", nil).Rows(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.True(t, rows.Next()) {
+		var id, name int64
+		err = rows.Scan(&id, &name)
+		assert.Error(t, err)
+		assert.Equal(t, err, rows.Err())
+	}
+	assert.NoError(t, rows.Close())
+
+	// rows is closed when Next returns false
+	fdb = newRowsDB()
+	qc = newFakeQuerierConstructor(t, fdb)
+	rows, err = qc.Query("SELECT id, name FROM t", nil).Rows(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 1, fdb.closed)
+	assert.NoError(t, rows.Close())
+	assert.Equal(t, 1, fdb.closed)
+}
@@ -0,0 +1,233 @@
+package squery_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+
+	logger "github.com/ipsusila/slog"
+	qy "github.com/ipsusila/squery"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDB is in-memory database/sql driver which records executed statements
+type fakeDB struct {
+	mu        sync.Mutex
+	stmts     []string         // executed statements, including BEGIN, COMMIT and ROLLBACK
+	affected  int64            // rows affected of every statement
+	lastIDErr error            // error of LastInsertId
+	errs      map[string]error // error of the statement
+	columns   []string         // columns of query result
+	values    [][]driver.Value // records of query result
+	rowsErr   error            // error returned after the last record
+	opened    int              // number of opened rows
+	closed    int              // number of closed rows
+}
+
+var (
+	fakeMu  sync.Mutex
+	fakeDBs = map[string]*fakeDB{}
+)
+
+type fakeDriver struct{}
+
+func init() {
+	sql.Register("squery_fake", fakeDriver{})
+}
+
+// newFakeDB opens sqlx handle of the fake database
+func newFakeDB(t *testing.T, fdb *fakeDB) *sqlx.DB {
+	fakeMu.Lock()
+	name := strconv.Itoa(len(fakeDBs))
+	fakeDBs[name] = fdb
+	fakeMu.Unlock()
+
+	db, err := sql.Open("squery_fake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return sqlx.NewDb(db, "sqlite3")
+}
+
+func newFakeQuerierConstructor(t *testing.T, fdb *fakeDB) qy.QuerierConstructor {
+	return qy.NewQuerierConstructor(newFakeDB(t, fdb), logger.NewDiscardLogger(logger.DebugLevel))
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeMu.Lock()
+	defer fakeMu.Unlock()
+	return &fakeConn{db: fakeDBs[name]}, nil
+}
+
+// record appends statement and return its error
+func (db *fakeDB) record(stmt string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.stmts = append(db.stmts, stmt)
+	return db.errs[stmt]
+}
+
+func (db *fakeDB) executed() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.stmts...)
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	stmt := "BEGIN"
+	if opts.ReadOnly {
+		stmt += " READ ONLY"
+	}
+	if err := c.db.record(stmt); err != nil {
+		return nil, err
+	}
+	return &fakeTx{db: c.db}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.db.record(query); err != nil {
+		return nil, err
+	}
+	return &fakeResult{db: c.db}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.db.record(query); err != nil {
+		return nil, err
+	}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.opened++
+	return &fakeRows{db: c.db}, nil
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (tx *fakeTx) Commit() error {
+	return tx.db.record("COMMIT")
+}
+
+func (tx *fakeTx) Rollback() error {
+	return tx.db.record("ROLLBACK")
+}
+
+type fakeResult struct {
+	db *fakeDB
+}
+
+func (r *fakeResult) LastInsertId() (int64, error) {
+	if r.db.lastIDErr != nil {
+		return 0, r.db.lastIDErr
+	}
+	return 7, nil
+}
+
+func (r *fakeResult) RowsAffected() (int64, error) {
+	return r.db.affected, nil
+}
+
+type fakeRows struct {
+	db  *fakeDB
+	idx int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.db.columns
+}
+
+func (r *fakeRows) Close() error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.db.closed++
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.idx >= len(r.db.values) {
+		if r.db.rowsErr != nil {
+			return r.db.rowsErr
+		}
+		return io.EOF
+	}
+	copy(dest, r.db.values[r.idx])
+	r.idx++
+	return nil
+}
+
+// fakeSelector builds fixed SELECT statement
+type fakeSelector struct {
+	qy.Selector
+}
+
+func (fakeSelector) Select(cols ...qy.Stringer) (string, []interface{}, error) {
+	return "SELECT id FROM t", nil, nil
+}
+
+func TestQuerierExec(t *testing.T) {
+	ctx := context.Background()
+	fdb := &fakeDB{affected: 2}
+	qc := newFakeQuerierConstructor(t, fdb)
+
+	res, err := qc.Query("UPDATE t SET a = ?", []interface{}{1}).Exec(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, qy.ExecResult{RowsAffected: 2, LastInsertID: 7}, res)
+
+	// number of affected rows does not match
+	q := qc.Query("DELETE FROM t WHERE id = ?", []interface{}{1}).MustAffect(1)
+	res, err = q.Exec(ctx)
+	var rae *qy.RowsAffectedError
+	if assert.True(t, errors.As(err, &rae)) {
+		assert.Equal(t, &qy.RowsAffectedError{Expected: 1, Actual: 2}, rae)
+		assert.EqualError(t, err, "expected 1 affected rows, got 2")
+	}
+	assert.Equal(t, int64(2), res.RowsAffected)
+	assert.Equal(t, err, q.Err())
+
+	res, err = qc.Query("DELETE FROM t", nil).MustAffect(2).Exec(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), res.RowsAffected)
+
+	// error of LastInsertId is ignored, e.g. postgres
+	fdb.lastIDErr = errors.New("LastInsertId is not supported by this driver")
+	res, err = qc.Query("UPDATE t SET a = 1", nil).Exec(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, qy.ExecResult{RowsAffected: 2}, res)
+
+	// error of the statement
+	fdb.errs = map[string]error{"UPDATE t SET b = 1": errors.New("exec failed")}
+	_, err = qc.Query("UPDATE t SET b = 1", nil).Exec(ctx)
+	assert.EqualError(t, err, "exec failed")
+
+	// selector only builds SELECT, nothing is executed
+	stmts := len(fdb.executed())
+	q = qc.WithSelector(fakeSelector{})
+	_, err = q.Exec(ctx)
+	assert.EqualError(t, err, "Exec is not supported by selector querier")
+	assert.Equal(t, err, q.Err())
+	assert.Len(t, fdb.executed(), stmts)
+}
@@ -0,0 +1,98 @@
+package squery
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	logger "github.com/ipsusila/slog"
+	"github.com/jmoiron/sqlx"
+)
+
+// txBeginner is implemented by *sqlx.DB and *sqlx.Conn
+type txBeginner interface {
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+}
+
+// Tx runs fn in transaction. Queries must be constructed using the QuerierConstructor passed to fn.
+// Transaction is committed if fn returns nil, and rolled back if fn returns error or panics.
+// Isolation level and read-only mode are set in opts (nil for default).
+// Nested call creates savepoint within the active transaction, opts of nested call is ignored.
+func (c *querierConstructor) Tx(ctx context.Context, opts *sql.TxOptions, fn func(QuerierConstructor) error) error {
+	if c.tx != nil {
+		return c.savepoint(ctx, fn)
+	}
+	b, ok := c.db.(txBeginner)
+	if !ok {
+		return errors.New("DB handle does not support transaction")
+	}
+
+	c.logIfDebug("begin transaction")
+	tx, err := b.BeginTxx(ctx, opts)
+	if err != nil {
+		c.log.Errorw("begin transaction error", "error", err.Error())
+		return err
+	}
+	txc := &querierConstructor{db: tx, log: c.log, tx: tx, level: 1}
+	return c.finish(fn, txc, tx.Commit, tx.Rollback, "transaction")
+}
+
+// savepoint runs fn within savepoint of the active transaction
+func (c *querierConstructor) savepoint(ctx context.Context, fn func(QuerierConstructor) error) error {
+	name := "sp_" + strconv.Itoa(c.level)
+	c.logIfDebug("create savepoint " + name)
+	if _, err := c.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		c.log.Errorw("create savepoint error", "savepoint", name, "error", err.Error())
+		return err
+	}
+	txc := &querierConstructor{db: c.tx, log: c.log, tx: c.tx, level: c.level + 1}
+	commit := func() error {
+		_, err := c.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+		return err
+	}
+	rollback := func() error {
+		// rollback is not cancelled by ctx of fn, e.g. fn failed because ctx is cancelled.
+		// Savepoint is released after rollback, so that it does not stay in the transaction.
+		if _, err := c.tx.ExecContext(context.Background(), "ROLLBACK TO SAVEPOINT "+name); err != nil {
+			return err
+		}
+		_, err := c.tx.ExecContext(context.Background(), "RELEASE SAVEPOINT "+name)
+		return err
+	}
+	return c.finish(fn, txc, commit, rollback, "savepoint "+name)
+}
+
+// finish calls fn, then commits or rolls back depending on the result of fn.
+// Panic is re-raised after rollback.
+func (c *querierConstructor) finish(fn func(QuerierConstructor) error, txc *querierConstructor,
+	commit, rollback func() error, what string) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			if rerr := rollback(); rerr != nil {
+				c.log.Errorw("rollback "+what+" error", "error", rerr.Error())
+			}
+			panic(p)
+		}
+	}()
+
+	if err = fn(txc); err != nil {
+		c.logIfDebug("rollback " + what)
+		if rerr := rollback(); rerr != nil {
+			c.log.Errorw("rollback "+what+" error", "error", rerr.Error())
+		}
+		return err
+	}
+
+	c.logIfDebug("commit " + what)
+	if err = commit(); err != nil {
+		c.log.Errorw("commit "+what+" error", "error", err.Error())
+	}
+	return err
+}
+
+func (c *querierConstructor) logIfDebug(msg string) {
+	if c.log.HasLevel(logger.DebugLevel) {
+		c.log.Debugw(msg, "level", c.level)
+	}
+}
@@ -0,0 +1,148 @@
+package squery_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	logger "github.com/ipsusila/slog"
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuerierTx(t *testing.T) {
+	ctx := context.Background()
+	exec := func(qc qy.QuerierConstructor, stmt string) error {
+		_, err := qc.Query(stmt, nil).Exec(ctx)
+		return err
+	}
+
+	// committed if fn returns nil
+	fdb := &fakeDB{}
+	err := newFakeQuerierConstructor(t, fdb).Tx(ctx, nil, func(qc qy.QuerierConstructor) error {
+		return exec(qc, "INSERT 1")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "INSERT 1", "COMMIT"}, fdb.executed())
+
+	// rolled back if fn returns error
+	fdb = &fakeDB{}
+	errFn := errors.New("fn failed")
+	err = newFakeQuerierConstructor(t, fdb).Tx(ctx, nil, func(qc qy.QuerierConstructor) error {
+		if err := exec(qc, "INSERT 1"); err != nil {
+			return err
+		}
+		return errFn
+	})
+	assert.Equal(t, errFn, err)
+	assert.Equal(t, []string{"BEGIN", "INSERT 1", "ROLLBACK"}, fdb.executed())
+
+	// rolled back and panic is re-raised
+	fdb = &fakeDB{}
+	qc := newFakeQuerierConstructor(t, fdb)
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = qc.Tx(ctx, nil, func(qc qy.QuerierConstructor) error {
+			panic("boom")
+		})
+	})
+	assert.Equal(t, []string{"BEGIN", "ROLLBACK"}, fdb.executed())
+
+	// error of commit is returned
+	fdb = &fakeDB{errs: map[string]error{"COMMIT": errors.New("commit failed")}}
+	err = newFakeQuerierConstructor(t, fdb).Tx(ctx, nil, func(qc qy.QuerierConstructor) error {
+		return nil
+	})
+	assert.EqualError(t, err, "commit failed")
+}
+
+func TestQuerierTxSavepoint(t *testing.T) {
+	ctx := context.Background()
+	exec := func(qc qy.QuerierConstructor, stmt string) error {
+		_, err := qc.Query(stmt, nil).Exec(ctx)
+		return err
+	}
+
+	// nested call creates savepoint, opts of nested call is ignored
+	fdb := &fakeDB{}
+	readOnly := &sql.TxOptions{ReadOnly: true}
+	err := newFakeQuerierConstructor(t, fdb).Tx(ctx, readOnly, func(qc qy.QuerierConstructor) error {
+		err := qc.Tx(ctx, &sql.TxOptions{}, func(qc qy.QuerierConstructor) error {
+			if err := exec(qc, "INSERT 1"); err != nil {
+				return err
+			}
+			return qc.Tx(ctx, nil, func(qc qy.QuerierConstructor) error {
+				return exec(qc, "INSERT 2")
+			})
+		})
+		if err != nil {
+			return err
+		}
+		err = qc.Tx(ctx, readOnly, func(qc qy.QuerierConstructor) error {
+			if err := exec(qc, "INSERT 3"); err != nil {
+				return err
+			}
+			return errors.New("discard INSERT 3")
+		})
+		assert.EqualError(t, err, "discard INSERT 3")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"BEGIN READ ONLY",
+		"SAVEPOINT sp_1",
+		"INSERT 1",
+		"SAVEPOINT sp_2",
+		"INSERT 2",
+		"RELEASE SAVEPOINT sp_2",
+		"RELEASE SAVEPOINT sp_1",
+		"SAVEPOINT sp_1",
+		"INSERT 3",
+		"ROLLBACK TO SAVEPOINT sp_1",
+		"RELEASE SAVEPOINT sp_1",
+		"COMMIT",
+	}, fdb.executed())
+
+	// panic in savepoint rolls back to the savepoint, then the transaction
+	fdb = &fakeDB{}
+	qc := newFakeQuerierConstructor(t, fdb)
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = qc.Tx(ctx, nil, func(qc qy.QuerierConstructor) error {
+			return qc.Tx(ctx, nil, func(qc qy.QuerierConstructor) error {
+				panic("boom")
+			})
+		})
+	})
+	assert.Equal(t, []string{"BEGIN", "SAVEPOINT sp_1", "ROLLBACK TO SAVEPOINT sp_1", "RELEASE SAVEPOINT sp_1", "ROLLBACK"},
+		fdb.executed())
+
+	// savepoint is rolled back although ctx of nested call is cancelled
+	fdb = &fakeDB{}
+	err = newFakeQuerierConstructor(t, fdb).Tx(ctx, nil, func(qc qy.QuerierConstructor) error {
+		cctx, cancel := context.WithCancel(ctx)
+		err := qc.Tx(cctx, nil, func(qc qy.QuerierConstructor) error {
+			cancel()
+			_, err := qc.Query("INSERT 1", nil).Exec(cctx)
+			return err
+		})
+		assert.True(t, errors.Is(err, context.Canceled))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "SAVEPOINT sp_1", "ROLLBACK TO SAVEPOINT sp_1", "RELEASE SAVEPOINT sp_1", "COMMIT"},
+		fdb.executed())
+
+	// constructor of active transaction creates savepoint
+	fdb = &fakeDB{}
+	tx, err := newFakeDB(t, fdb).Beginx()
+	if !assert.NoError(t, err) {
+		return
+	}
+	qc = qy.NewQuerierConstructor(tx, logger.NewDiscardLogger(logger.DebugLevel))
+	err = qc.Tx(ctx, readOnly, func(qc qy.QuerierConstructor) error {
+		return exec(qc, "INSERT 1")
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+	assert.Equal(t, []string{"BEGIN", "SAVEPOINT sp_1", "INSERT 1", "RELEASE SAVEPOINT sp_1", "COMMIT"}, fdb.executed())
+}
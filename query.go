@@ -48,90 +48,48 @@ func (q *query) build(sb StringBuilder, ph Placeholder, isCount bool, cols ...St
 	if q.from == nil {
 		return nil, errors.New("FROM clause can not be empty")
 	}
-	var args []interface{}
 	sb.WriteString("SELECT ")
-	if len(cols) == 0 {
-		sb.WriteString("*")
-	} else {
-		sb.WriteString(cols[0].String())
-		for idx := 1; idx < len(cols); idx++ {
-			sb.WriteByte(bComma)
-			sb.WriteString(cols[idx].String())
-		}
+	args, err := writeColumns(sb, ph, cols)
+	if err != nil {
+		return nil, err
 	}
 	sb.WriteString(" FROM ")
-	sb.WriteString(q.from.String())
-	if nexp := len(q.whereExprs); nexp > 0 {
-		addWhere := true
-		for idx, e := range q.whereExprs {
-			if e.IsEmpty() {
-				continue
-			}
-			if addWhere {
-				addWhere = false
-				sb.WriteString(" WHERE ")
-			}
-			if idx > 0 {
-				sb.WriteString(" AND ")
-			}
-
-			if nexp > 1 {
-				sb.WriteByte(bLParenthesis)
-			}
-			varg, err := e.Build(sb, ph)
-			if err != nil {
-				return nil, err
-			}
-			if nexp > 1 {
-				sb.WriteByte(bRParenthesis)
-			}
-			args = append(args, varg...)
-		}
+	writeTerm(sb, ph, q.from)
+	varg, err := writeConditions(sb, ph, " WHERE ", q.whereExprs)
+	if err != nil {
+		return nil, err
 	}
+	args = append(args, varg...)
 
 	// Add group by if not SELECT COUNT(*)
 	//if !isCount {
 	// For select count, we do need limit, offset, order by
-	if q.groupBy != nil {
+	if !isEmptyStringer(q.groupBy) {
 		sb.WriteString(" GROUP BY ")
-		sb.WriteString(q.groupBy.String())
+		varg, err = writeStringer(sb, ph, q.groupBy)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, varg...)
 	}
 	//}
 
 	// process HAVING clause
-	if nexp := len(q.havingExprs); nexp > 0 {
-		addHaving := true
-		for idx, e := range q.havingExprs {
-			if e.IsEmpty() {
-				continue
-			}
-			if addHaving {
-				addHaving = false
-				sb.WriteString(" HAVING ")
-			}
-			if idx > 0 {
-				sb.WriteString(" AND ")
-			}
-
-			if nexp > 1 {
-				sb.WriteByte(bLParenthesis)
-			}
-			varg, err := e.Build(sb, ph)
-			if err != nil {
-				return nil, err
-			}
-			if nexp > 1 {
-				sb.WriteByte(bRParenthesis)
-			}
-			args = append(args, varg...)
-		}
+	varg, err = writeConditions(sb, ph, " HAVING ", q.havingExprs)
+	if err != nil {
+		return nil, err
 	}
+	args = append(args, varg...)
 
 	// ADD ORDER BY, limit and offset if not count(*)
 	if !isCount {
-		if q.orderBy != nil {
+		if !isEmptyStringer(q.orderBy) {
 			sb.WriteString(" ORDER BY ")
-			sb.WriteString(q.orderBy.String())
+			varg, err = writeStringer(sb, ph, q.orderBy)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, varg...)
 		}
 
 		if q.limit > 0 {
@@ -152,6 +110,45 @@ func (q *query) build(sb StringBuilder, ph Placeholder, isCount bool, cols ...St
 	return args, nil
 }
 
+// writeConditions writes non empty expressions joined with AND and prefixed with clause keyword,
+// e.g. " WHERE ". Nothing is written if all expressions are empty.
+func writeConditions(sb StringBuilder, ph Placeholder, clause string, exprs []Expression) ([]interface{}, error) {
+	var args []interface{}
+	nexp := 0
+	for _, e := range exprs {
+		if e != nil && !e.IsEmpty() {
+			nexp++
+		}
+	}
+	if nexp == 0 {
+		return nil, nil
+	}
+
+	sb.WriteString(clause)
+	idx := 0
+	for _, e := range exprs {
+		if e == nil || e.IsEmpty() {
+			continue
+		}
+		if idx > 0 {
+			sb.WriteString(" AND ")
+		}
+		if nexp > 1 {
+			sb.WriteByte(bLParenthesis)
+		}
+		varg, err := e.Build(sb, ph)
+		if err != nil {
+			return nil, err
+		}
+		if nexp > 1 {
+			sb.WriteByte(bRParenthesis)
+		}
+		args = append(args, varg...)
+		idx++
+	}
+	return args, nil
+}
+
 func (q *query) IsEmpty() bool {
 	return q.from == nil || q.from.String() == ""
 }
@@ -0,0 +1,197 @@
+package squery
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Template file naming convention.
+// `name.sql` stores select template and optional `name.count.sql` stores count template.
+const (
+	TemplateExt      = ".sql"
+	CountTemplateExt = ".count.sql"
+)
+
+// queryTemplate stores pair of select and count template
+type queryTemplate struct {
+	selTpl string
+	cntTpl string
+}
+
+// TemplateRegistry stores named query templates loaded from file system, e.g. embed.FS.
+// Template name is the file path relative to the root without extension,
+// e.g. `reports/country_list.sql` is registered as `reports/country_list`.
+type TemplateRegistry struct {
+	fsys    fs.FS
+	dialect Dialect
+
+	mu        sync.RWMutex
+	templates map[string]*queryTemplate
+	stamp     string
+}
+
+// NewTemplateRegistry loads and validates all templates in fsys.
+func NewTemplateRegistry(fsys fs.FS) (*TemplateRegistry, error) {
+	r := &TemplateRegistry{fsys: fsys, dialect: Postgres}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads all templates again. When error occurs, previously loaded templates are kept.
+func (r *TemplateRegistry) Reload() error {
+	// fingerprint is taken first, so that file changed while loading is reloaded by Watch
+	stamp, err := r.fingerprint()
+	if err != nil {
+		return err
+	}
+	templates, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.templates = templates
+	r.stamp = stamp
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Query construct template query of given template name
+func (r *TemplateRegistry) Query(name string, fm FnMapField, fv FieldValues) (TemplateQuery, error) {
+	r.mu.RLock()
+	tpl, ok := r.templates[name]
+	dialect := r.dialect
+	r.mu.RUnlock()
+	if !ok {
+		return nil, errors.New("query template " + name + " not found")
+	}
+	return NewTemplateQuery(tpl.selTpl, tpl.cntTpl, fm, fv).Dialect(dialect), nil
+}
+
+// Dialect set dialect of constructed template queries
+func (r *TemplateRegistry) Dialect(d Dialect) *TemplateRegistry {
+	r.mu.Lock()
+	r.dialect = d
+	r.mu.Unlock()
+	return r
+}
+
+// Names return sorted list of registered template names
+func (r *TemplateRegistry) Names() []string {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// Watch polls the file system every interval and reloads templates when any file changes.
+// It is intended for development and blocks until ctx is done.
+// Reload error is passed to onError (if not nil) and previous templates are kept.
+func (r *TemplateRegistry) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stamp, err := r.fingerprint()
+			if err == nil {
+				r.mu.RLock()
+				changed := stamp != r.stamp
+				r.mu.RUnlock()
+				if !changed {
+					continue
+				}
+				err = r.Reload()
+			}
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// load reads and validates all templates
+func (r *TemplateRegistry) load() (map[string]*queryTemplate, error) {
+	templates := make(map[string]*queryTemplate)
+	counts := make(map[string]string)
+	err := fs.WalkDir(r.fsys, ".", func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(fpath) != TemplateExt {
+			return nil
+		}
+		data, err := fs.ReadFile(r.fsys, fpath)
+		if err != nil {
+			return err
+		}
+		tpl := string(data)
+		if _, err := parseTemplate(tpl); err != nil {
+			return errors.New(fpath + ": " + err.Error())
+		}
+
+		if strings.HasSuffix(fpath, CountTemplateExt) {
+			counts[strings.TrimSuffix(fpath, CountTemplateExt)] = tpl
+		} else {
+			templates[strings.TrimSuffix(fpath, TemplateExt)] = &queryTemplate{selTpl: tpl}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// pair count template with select template
+	for name, cntTpl := range counts {
+		tpl, ok := templates[name]
+		if !ok {
+			return nil, errors.New(name + CountTemplateExt + ": select template " + name + TemplateExt + " not found")
+		}
+		tpl.cntTpl = cntTpl
+	}
+
+	return templates, nil
+}
+
+// fingerprint summarizes name, size and modification time of the templates
+func (r *TemplateRegistry) fingerprint() (string, error) {
+	sb := strings.Builder{}
+	err := fs.WalkDir(r.fsys, ".", func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(fpath) != TemplateExt {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sb.WriteString(fpath)
+		sb.WriteByte(bSpace)
+		sb.WriteString(strconv.FormatInt(info.Size(), 10))
+		sb.WriteByte(bSpace)
+		sb.WriteString(strconv.FormatInt(info.ModTime().UnixNano(), 10))
+		sb.WriteByte('\n')
+		return nil
+	})
+	return sb.String(), err
+}
@@ -0,0 +1,168 @@
+package squery_test
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateRegistry(t *testing.T) {
+	fsys := fstest.MapFS{
+		"country_list.sql":         {Data: []byte("SELECT {{COLUMNS}} FROM country {{WHERE}} {{ORDERBY}} {{LIMIT}}")},
+		"country_list.count.sql":   {Data: []byte("SELECT {{COLUMNS}} FROM country {{WHERE}}")},
+		"reports/district.sql":     {Data: []byte("SELECT * FROM district {{WHERE}}")},
+		"reports/README.md":        {Data: []byte("not a template")},
+		"reports/district_old.txt": {Data: []byte("DELETE FROM district")},
+	}
+	reg, err := qy.NewTemplateRegistry(fsys)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"country_list", "reports/district"}, reg.Names())
+
+	q, err := reg.Query("country_list", nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	q.Where(qy.Expr.Eq(qy.F("code"), "ID")).Limit(10)
+	query, args, err := q.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT COUNT(*) FROM country  WHERE ("code" = $1)`, query)
+	assert.Equal(t, []interface{}{"ID"}, args)
+
+	_, err = reg.Query("unknown", nil, nil)
+	assert.Error(t, err)
+
+	// invalid template is rejected at load time
+	fsys["invalid.sql"] = &fstest.MapFile{Data: []byte("DELETE FROM country")}
+	_, err = qy.NewTemplateRegistry(fsys)
+	assert.Error(t, err)
+
+	// count template without select template
+	delete(fsys, "invalid.sql")
+	fsys["orphan.count.sql"] = &fstest.MapFile{Data: []byte("SELECT COUNT(*) FROM orphan")}
+	assert.Error(t, reg.Reload())
+	assert.Len(t, reg.Names(), 2)
+}
+
+func TestTemplateRegistryDialect(t *testing.T) {
+	fsys := fstest.MapFS{
+		"country.sql": {Data: []byte("SELECT * FROM country {{WHERE}}")},
+	}
+	reg, err := qy.NewTemplateRegistry(fsys)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// dialect may be changed while queries are constructed
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			reg.Dialect(qy.MySQL)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_, err := reg.Query("country", nil, nil)
+		assert.NoError(t, err)
+	}
+	<-done
+
+	q, err := reg.Query("country", nil, nil)
+	if assert.NoError(t, err) {
+		q.Where(qy.Expr.Eq(qy.F("code"), "ID"))
+		query, args, err := q.Select()
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM country  WHERE (`code` = ?)", query)
+		assert.Equal(t, []interface{}{"ID"}, args)
+	}
+}
+
+// watchFS is file system which can be changed while it is watched
+type watchFS struct {
+	mu   sync.Mutex
+	fsys fstest.MapFS
+}
+
+func (w *watchFS) Open(name string) (fs.File, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.fsys.Open(name)
+}
+
+// write replaces the file, so that opened files are not changed
+func (w *watchFS) write(name, data string, modTime time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.fsys[name] = &fstest.MapFile{Data: []byte(data), ModTime: modTime}
+}
+
+func TestTemplateRegistryWatch(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	wfs := &watchFS{fsys: fstest.MapFS{
+		"country.sql": {Data: []byte("SELECT * FROM country {{WHERE}}"), ModTime: start},
+	}}
+	reg, err := qy.NewTemplateRegistry(wfs)
+	if !assert.NoError(t, err) {
+		return
+	}
+	selectOf := func(name string) string {
+		q, err := reg.Query(name, nil, nil)
+		if err != nil {
+			return ""
+		}
+		query, _, _ := q.Select()
+		return query
+	}
+	waitFor := func(cond func() bool) bool {
+		for i := 0; i < 200; i++ {
+			if cond() {
+				return true
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	onError := func(err error) {
+		// error is reported on every tick until the template is fixed
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		reg.Watch(ctx, time.Millisecond, onError)
+	}()
+
+	// changed template is reloaded
+	wfs.write("country.sql", "SELECT id FROM country {{WHERE}}", start.Add(time.Second))
+	assert.True(t, waitFor(func() bool { return selectOf("country") == "SELECT id FROM country " }))
+
+	// invalid template is reported, previous templates are kept
+	wfs.write("invalid.sql", "DELETE FROM country", start)
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Error("reload error is not reported")
+	}
+	assert.Equal(t, []string{"country"}, reg.Names())
+
+	// fixed template is loaded
+	wfs.write("invalid.sql", "SELECT * FROM city", start.Add(time.Second))
+	assert.True(t, waitFor(func() bool { return len(reg.Names()) == 2 }))
+
+	cancel()
+	<-stopped
+}
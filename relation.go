@@ -0,0 +1,158 @@
+package squery
+
+import "errors"
+
+// Relation declares child table which can be filtered from parent with $some, $none or $every,
+// e.g. {"orders": {"$some": {"total": {"$gt": 100}}}}. The filter is compiled into
+// correlated EXISTS subquery. Child fields must be declared either by FieldMapper or Schema,
+// unknown child field is rejected by Parse.
+type Relation struct {
+	Table       string        // child table, e.g. orders
+	Alias       string        // alias of child table in subquery, default to Table
+	ParentKey   string        // SQL expression of the parent key, e.g. c.id
+	ChildKey    string        // column of child table that refers to parent key, e.g. customer_id
+	FieldMapper FnMapField    // maps child fields, error is returned for unknown field
+	Schema      *FilterSchema // validates child fields, default column is quoted alias.field
+	Relations   Relations     // nested relations of the child table
+}
+
+// Relations maps filter field into relation
+type Relations map[string]*Relation
+
+// alias of the child table
+func (r *Relation) alias() string {
+	if r.Alias != "" {
+		return r.Alias
+	}
+	return r.Table
+}
+
+// isRelationOperator return true for $some, $none and $every
+func isRelationOperator(op string) bool {
+	switch op {
+	case opSome, opNone, opEvery:
+		return true
+	}
+	return false
+}
+
+// writeRelation writes relation operator applied to field, e.g.
+// (EXISTS (SELECT 1 FROM orders AS "orders" WHERE "orders"."customer_id" = c.id AND (...)))
+func (fn *treeNode) writeRelation(sb StringBuilder, arg *SqlExpression, field *treeNode) error {
+	rel, ok := arg.relations[field.Term]
+	if !ok || rel == nil {
+		return errors.New(field.Term + ": relation not found for " + fn.Term + " operator")
+	}
+	if fn.ValueType != tOperator {
+		return errors.New(field.Term + ": " + fn.Term + " operator needs object value")
+	}
+	if rel.FieldMapper == nil && rel.Schema == nil {
+		return errors.New(field.Term + ": relation needs FieldMapper or Schema")
+	}
+
+	sb.WriteByte(bLParenthesis)
+	if fn.Term != opSome {
+		sb.WriteString(sqlNot)
+		sb.WriteByte(bSpace)
+	}
+	sb.WriteString("EXISTS (SELECT 1 FROM ")
+	sb.WriteString(rel.Table)
+	sb.WriteString(" AS ")
+	d := arg.sqlDialect()
+	sb.WriteString(d.QuoteIdent(rel.alias()))
+	sb.WriteString(" WHERE ")
+	sb.WriteString(d.QuoteIdent(rel.alias() + "." + rel.ChildKey))
+	sb.WriteString(" = ")
+	sb.WriteString(rel.ParentKey)
+
+	if len(fn.Children) > 0 {
+		childArg := &SqlExpression{
+			ph:        arg.ph,
+			fm:        rel.FieldMapper,
+			schema:    rel.Schema,
+			dialect:   arg.dialect,
+			relations: rel.Relations,
+			operators: arg.operators,
+			alias:     rel.alias(),
+		}
+		sb.WriteString(" AND ")
+		if err := fn.writeChildren(sb, childArg, nil, sqlAnd); err != nil {
+			return err
+		}
+		if fn.Term == opEvery {
+			// no child whose condition is not TRUE, condition evaluated to NULL is not TRUE
+			sb.WriteString(" IS NOT TRUE")
+		}
+
+		arg.Args = append(arg.Args, childArg.Args...)
+		for i, childField := range childArg.Fields {
+			arg.Fields = append(arg.Fields, field.Term+"."+childField)
+			arg.SqlFields = append(arg.SqlFields, childArg.SqlFields[i])
+		}
+	}
+	sb.WriteString("))")
+
+	return nil
+}
+
+// hasRelationOperators return true if all children of the field are relation operators
+func (fn *treeNode) hasRelationOperators() bool {
+	for _, child := range fn.Children {
+		if !isRelationOperator(child.Term) {
+			return false
+		}
+	}
+	return len(fn.Children) > 0
+}
+
+// validateRelations checks fields filtered using relation operators. Fields of the child table
+// are validated by Schema of the relation, or by its FieldMapper if there is no schema.
+func validateRelations(nd *treeNode, relations Relations) FilterErrors {
+	if nd.isOperator() || nd.isRoot || nd.isLogical() || !nd.hasRelationOperators() {
+		var errs FilterErrors
+		for _, child := range nd.Children {
+			errs = append(errs, validateRelations(child, relations)...)
+		}
+		return errs
+	}
+
+	rel, ok := relations[nd.Term]
+	if !ok || rel == nil {
+		return FilterErrors{newFilterError(nd, ErrCodeUnknownField, "relation "+nd.Term+" not found", nil)}
+	}
+	if rel.FieldMapper == nil && rel.Schema == nil {
+		return FilterErrors{newFilterError(nd, ErrCodeUnknownField, "relation "+nd.Term+" needs FieldMapper or Schema", nil)}
+	}
+	var errs FilterErrors
+	for _, op := range nd.Children {
+		if op.ValueType != tOperator {
+			errs = append(errs, newFilterError(op, ErrCodeInvalidValue, op.Term+" operator needs object value", nil))
+			continue
+		}
+		for _, child := range op.Children {
+			if rel.Schema != nil {
+				errs = append(errs, rel.Schema.validateNode(child, "", nil)...)
+			} else {
+				errs = append(errs, validateMappedFields(child, rel.FieldMapper)...)
+			}
+			errs = append(errs, validateRelations(child, rel.Relations)...)
+		}
+	}
+	return errs
+}
+
+// validateMappedFields checks that every field of the node is known by the field mapper
+func validateMappedFields(nd *treeNode, fm FnMapField) FilterErrors {
+	var errs FilterErrors
+	switch {
+	case nd.isRoot || nd.isLogical():
+		for _, child := range nd.Children {
+			errs = append(errs, validateMappedFields(child, fm)...)
+		}
+	case !nd.isOperator() && !nd.hasRelationOperators():
+		if _, err := fm(nd.Term); err != nil {
+			errs = append(errs, newFilterError(nd, ErrCodeUnknownField, err.Error(), err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,119 @@
+package squery_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeRelations(t *testing.T) {
+	relations := qy.Relations{
+		"orders": {
+			Table:     "orders",
+			ParentKey: "c.id",
+			ChildKey:  "customer_id",
+			Schema: qy.NewFilterSchema().
+				Field("total", qy.FieldSchema{Type: qy.FieldInt}).
+				Field("status", qy.FieldSchema{Type: qy.FieldText}),
+			Relations: qy.Relations{
+				"items": {
+					Table:     "order_items",
+					Alias:     "oi",
+					ParentKey: `"orders"."id"`,
+					ChildKey:  "order_id",
+					FieldMapper: func(field string) (string, error) {
+						if field != "qty" {
+							return "", errors.New("unknown field " + field)
+						}
+						return `"oi"."qty"`, nil
+					},
+				},
+			},
+		},
+		"notes": {Table: "notes", ParentKey: "c.id", ChildKey: "customer_id"},
+	}
+	fm := func(field string) (string, error) {
+		return "c." + field, nil
+	}
+	tests := []struct {
+		filter string
+		clause string
+		args   []interface{}
+	}{
+		{
+			`{"name": "A", "orders": {"$some": {"total": {"$gt": 100}}}}`,
+			`((c.name = $1) AND (EXISTS (SELECT 1 FROM orders AS "orders" WHERE "orders"."customer_id" = c.id AND (("orders"."total" > $2)))))`,
+			[]interface{}{"A", int64(100)},
+		},
+		{
+			`{"orders": {"$none": {}}}`,
+			`(NOT EXISTS (SELECT 1 FROM orders AS "orders" WHERE "orders"."customer_id" = c.id))`,
+			nil,
+		},
+		{
+			`{"orders": {"$every": {"status": "paid", "items": {"$some": {"qty": {"$gte": 2}}}}}}`,
+			`(NOT EXISTS (SELECT 1 FROM orders AS "orders" WHERE "orders"."customer_id" = c.id AND (("orders"."status" = $1) AND (EXISTS (SELECT 1 FROM order_items AS "oi" WHERE "oi"."order_id" = "orders"."id" AND (("oi"."qty" >= $2))))) IS NOT TRUE))`,
+			[]interface{}{"paid", int64(2)},
+		},
+	}
+	for _, test := range tests {
+		tree, err := qy.NewTree(fm).Relations(relations).Parse([]byte(test.filter))
+		if !assert.NoError(t, err, test.filter) {
+			continue
+		}
+		sb := strings.Builder{}
+		args, err := tree.Build(&sb, qy.NewPsqlPlaceholder())
+		assert.NoError(t, err, test.filter)
+		assert.Equal(t, test.clause, sb.String(), test.filter)
+		assert.Equal(t, test.args, args, test.filter)
+	}
+
+	// child fields must be declared, values are converted by schema of the relation
+	invalids := map[string]string{
+		`{"orders": {"$some": {"password_hash": {"$startsWith": "a"}}}}`:            "$.orders.$some.password_hash",
+		`{"orders": {"$some": {"total": "abc"}}}`:                                   "$.orders.$some.total",
+		`{"orders": {"$some": {"items": {"$some": {"secret": 1}}}}}`:                "$.orders.$some.items.$some.secret",
+		`{"orders": {"$some": {"$or": [{"status": "a"}, {"password_hash": "x"}]}}}`: "$.orders.$some.$or[1].password_hash",
+		`{"notes": {"$some": {"text": "a"}}}`:                                       "$.notes",
+		`{"unknown": {"$some": {"a": 1}}}`:                                          "$.unknown",
+		`{"orders": {"$some": 1}}`:                                                  "$.orders.$some",
+	}
+	for filter, path := range invalids {
+		_, err := qy.NewTree(fm).Relations(relations).Parse([]byte(filter))
+		var errs qy.FilterErrors
+		if assert.True(t, errors.As(err, &errs), filter) {
+			assert.Equal(t, path, errs[0].Path, filter)
+		}
+	}
+
+	// alias and default column of the child are quoted by dialect of the tree or the placeholder
+	const someFilter = `{"orders": {"$some": {"total": {"$gt": 100}}}}`
+	const mysqlClause = "(EXISTS (SELECT 1 FROM orders AS `orders` WHERE `orders`.`customer_id` = c.id AND ((`orders`.`total` > ?))))"
+	tree, err := qy.NewTree(fm).Relations(relations).Dialect(qy.MySQL).Parse([]byte(someFilter))
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		_, err = tree.Build(&sb, qy.NewQmPlaceholder())
+		assert.NoError(t, err)
+		assert.Equal(t, mysqlClause, sb.String())
+	}
+	tree, err = qy.NewTree(fm).Relations(relations).Parse([]byte(someFilter))
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		_, err = tree.Build(&sb, qy.MySQL.Placeholder())
+		assert.NoError(t, err)
+		assert.Equal(t, mysqlClause, sb.String())
+	}
+
+	// identifier is escaped by doubling the quote
+	assert.Equal(t, `"orders"."a""b"`, qy.F(`orders.a"b`).String())
+
+	tree, err = qy.NewTree(fm).Parse([]byte(`{"orders": {"$some": {"total": 1}}}`))
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		_, err = tree.Build(&sb, qy.NewPsqlPlaceholder())
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,342 @@
+package squery
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// RSQLError is parse error of RSQL query
+type RSQLError struct {
+	Offset  int    // byte offset in the query
+	Message string // description of the error
+}
+
+// Error interface
+func (e *RSQLError) Error() string {
+	return "rsql: " + e.Message + " at offset " + strconv.Itoa(e.Offset)
+}
+
+// rsqlOperators maps FIQL/RSQL comparison operator into filter operator,
+// other =op= is mapped into $op of the JSON filter, e.g. =ilike= into $ilike
+var rsqlOperators = map[string]string{
+	"==":    opEq,
+	"!=":    opNeq,
+	"=gt=":  opGt,
+	">":     opGt,
+	"=ge=":  opGte,
+	">=":    opGte,
+	"=lt=":  opLt,
+	"<":     opLt,
+	"=le=":  opLte,
+	"<=":    opLte,
+	"=in=":  opIn,
+	"=out=": opNotIn,
+	"=re=":  opRegex,
+}
+
+// ParseRSQL converts RSQL/FIQL query, e.g. name==John;age=gt=30,status=in=(A,B), into the tree.
+// The query is converted into JSON filter and parsed using Parse, so that field mapper, schema
+// and limits of the tree are respected. Logical operators are ; or and (AND), and , or or (OR).
+// Unquoted value of == and != containing * is matched with LIKE, where * is any string.
+// Syntax error is returned as *RSQLError.
+func (t *Tree) ParseRSQL(query string) (*Tree, error) {
+	data, err := RSQLToJSON(query)
+	if err != nil {
+		return nil, err
+	}
+	return t.Parse(data)
+}
+
+// RSQLToJSON converts RSQL/FIQL query into JSON filter
+func RSQLToJSON(query string) (json.RawMessage, error) {
+	p := rsqlParser{query: query}
+	p.skipSpace()
+	if p.eof() {
+		return nil, nil
+	}
+	obj, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf("unexpected character " + strconv.Quote(p.query[p.pos:p.pos+1]))
+	}
+	return json.Marshal(obj)
+}
+
+// rsqlParser is recursive descent parser of RSQL
+type rsqlParser struct {
+	query string
+	pos   int
+}
+
+func (p *rsqlParser) eof() bool {
+	return p.pos >= len(p.query)
+}
+
+func (p *rsqlParser) errorf(msg string) error {
+	return &RSQLError{Offset: p.pos, Message: msg}
+}
+
+func (p *rsqlParser) skipSpace() bool {
+	start := p.pos
+	for !p.eof() && isRSQLSpace(p.query[p.pos]) {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+// keyword consumes logical operator, i.e. sep or keyword surrounded by spaces
+func (p *rsqlParser) keyword(sep byte, keyword string) bool {
+	start := p.pos
+	spaced := p.skipSpace()
+	if !p.eof() && p.query[p.pos] == sep {
+		p.pos++
+		p.skipSpace()
+		return true
+	}
+	if spaced && strings.HasPrefix(p.query[p.pos:], keyword) {
+		end := p.pos + len(keyword)
+		if end < len(p.query) && isRSQLSpace(p.query[end]) {
+			p.pos = end
+			p.skipSpace()
+			return true
+		}
+	}
+	p.pos = start
+	return false
+}
+
+// or := and ((',' | ' or ') and)*
+func (p *rsqlParser) parseOr() (filterObject, error) {
+	items := []filterObject{}
+	for {
+		obj, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, obj)
+		if !p.keyword(bComma, "or") {
+			break
+		}
+	}
+	return orFilter(items), nil
+}
+
+// and := constraint ((';' | ' and ') constraint)*
+func (p *rsqlParser) parseAnd() (filterObject, error) {
+	items := []filterObject{}
+	for {
+		obj, err := p.parseConstraint()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, obj)
+		if !p.keyword(';', "and") {
+			break
+		}
+	}
+	return andFilter(items), nil
+}
+
+// constraint := '(' or ')' | selector comparator arguments
+func (p *rsqlParser) parseConstraint() (filterObject, error) {
+	p.skipSpace()
+	if !p.eof() && p.query[p.pos] == bLParenthesis {
+		p.pos++
+		p.skipSpace()
+		obj, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.eof() || p.query[p.pos] != bRParenthesis {
+			return nil, p.errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return obj, nil
+	}
+
+	field := p.unreserved()
+	if field == "" {
+		return nil, p.errorf("missing selector")
+	}
+	p.skipSpace()
+	opPos := p.pos
+	op, err := p.comparator()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	values, quoted, err := p.arguments()
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch op {
+	case opIn, opNotIn, opBetween:
+		list := make([]interface{}, len(values))
+		for i, v := range values {
+			list[i] = rsqlValue(v, quoted[i])
+		}
+		value = list
+	default:
+		if len(values) != 1 {
+			return nil, &RSQLError{Offset: opPos, Message: "operator " + op + " needs single argument"}
+		}
+		value = rsqlValue(values[0], quoted[0])
+		if str, ok := value.(string); ok && !quoted[0] && strings.Contains(str, "*") && (op == opEq || op == opNeq) {
+			// wildcard, e.g. name==Jo*
+			value = strings.ReplaceAll(escapeLike(str), "*", "%")
+			if op == opEq {
+				op = opLike
+			} else {
+				op = opNotLike
+			}
+		}
+	}
+	if op == opEq {
+		return filterObject{{key: field, value: value}}, nil
+	}
+	return filterObject{{key: field, value: filterObject{{key: op, value: value}}}}, nil
+}
+
+// comparator := '==' | '!=' | '<' | '<=' | '>' | '>=' | '=' alpha+ '='
+func (p *rsqlParser) comparator() (string, error) {
+	rest := p.query[p.pos:]
+	for _, sym := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if strings.HasPrefix(rest, sym) {
+			p.pos += len(sym)
+			return rsqlOperators[sym], nil
+		}
+	}
+	if strings.HasPrefix(rest, "=") {
+		if end := strings.IndexByte(rest[1:], '='); end > 0 {
+			sym := rest[:end+2]
+			name := sym[1 : len(sym)-1]
+			op, ok := rsqlOperators[sym]
+			if !ok {
+				op = "$" + name
+			}
+			if _, known := opToSQL[op]; known && !isRSQLLogical(op) && isRSQLName(name) {
+				p.pos += len(sym)
+				return op, nil
+			}
+			return "", p.errorf("unknown operator " + sym)
+		}
+	}
+	return "", p.errorf("missing comparison operator")
+}
+
+// arguments := '(' value (',' value)* ')' | value
+func (p *rsqlParser) arguments() ([]string, []bool, error) {
+	if p.eof() || p.query[p.pos] != bLParenthesis {
+		v, quoted, err := p.value()
+		if err != nil {
+			return nil, nil, err
+		}
+		return []string{v}, []bool{quoted}, nil
+	}
+
+	p.pos++
+	values, quotes := []string{}, []bool{}
+	for {
+		p.skipSpace()
+		v, quoted, err := p.value()
+		if err != nil {
+			return nil, nil, err
+		}
+		values = append(values, v)
+		quotes = append(quotes, quoted)
+		p.skipSpace()
+		if p.eof() {
+			return nil, nil, p.errorf("missing closing parenthesis")
+		}
+		switch p.query[p.pos] {
+		case bComma:
+			p.pos++
+			continue
+		case bRParenthesis:
+			p.pos++
+			return values, quotes, nil
+		}
+		return nil, nil, p.errorf("unexpected character " + strconv.Quote(p.query[p.pos:p.pos+1]))
+	}
+}
+
+// value := unreserved+ | '"' ... '"' | "'" ... "'", backslash escapes next character
+func (p *rsqlParser) value() (string, bool, error) {
+	if p.eof() {
+		return "", false, p.errorf("missing argument")
+	}
+	quote := p.query[p.pos]
+	if quote != '"' && quote != '\'' {
+		v := p.unreserved()
+		if v == "" {
+			return "", false, p.errorf("missing argument")
+		}
+		return v, false, nil
+	}
+
+	start := p.pos
+	p.pos++
+	sb := strings.Builder{}
+	for !p.eof() {
+		c := p.query[p.pos]
+		switch {
+		case c == bBackslash && p.pos+1 < len(p.query):
+			sb.WriteByte(p.query[p.pos+1])
+			p.pos += 2
+		case c == quote:
+			p.pos++
+			return sb.String(), true, nil
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+	p.pos = start
+	return "", false, p.errorf("unterminated quoted argument")
+}
+
+// unreserved consumes characters other than reserved characters and spaces
+func (p *rsqlParser) unreserved() string {
+	start := p.pos
+	for !p.eof() && !isRSQLReserved(p.query[p.pos]) {
+		p.pos++
+	}
+	return p.query[start:p.pos]
+}
+
+// rsqlValue converts unquoted argument into number, boolean or null if possible
+func rsqlValue(v string, quoted bool) interface{} {
+	if quoted {
+		return v
+	}
+	return urlScalar(v)
+}
+
+func isRSQLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isRSQLReserved(c byte) bool {
+	return isRSQLSpace(c) || strings.IndexByte(`"'();,=!~<>`, c) >= 0
+}
+
+func isRSQLLogical(op string) bool {
+	return op == opAnd || op == opOr || op == opNot || op == opNor
+}
+
+func isRSQLName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return name != ""
+}
@@ -0,0 +1,78 @@
+package squery_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRSQL(t *testing.T) {
+	tests := []struct {
+		query  string
+		filter string
+	}{
+		{`name==John;age=gt=30,status=in=(A,B)`,
+			`{"$or":[{"$and":{"name":"John","age":{"$gt":30}}},{"status":{"$in":["A","B"]}}]}`},
+		{`name==John and (age>=18 or age<10)`,
+			`{"name":"John","$or":[{"age":{"$gte":18}},{"age":{"$lt":10}}]}`},
+		{`age=ge=1;age=le=9`, `{"$and":[{"age":{"$gte":1}},{"age":{"$lte":9}}]}`},
+		{`name=="Jo*";title==Jo*_x;code!=A*`,
+			`{"name":"Jo*","title":{"$like":"Jo%\\_x"},"code":{"$nlike":"A%"}}`},
+		{`name=ilike='%a b%';id=out=(1,'2');deleted==null`,
+			`{"name":{"$ilike":"%a b%"},"id":{"$nin":[1,"2"]},"deleted":null}`},
+		{`age=between=(1,5)`, `{"age":{"$between":[1,5]}}`},
+		{` `, ``},
+	}
+	for _, test := range tests {
+		data, err := qy.RSQLToJSON(test.query)
+		if assert.NoError(t, err, test.query) {
+			assert.Equal(t, test.filter, string(data), test.query)
+		}
+	}
+
+	fm := func(field string) (string, error) {
+		return `"` + field + `"`, nil
+	}
+	tree, err := qy.NewTree(fm).ParseRSQL(`name==John;age=gt=30,status=in=(A,B)`)
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		args, err := tree.Build(&sb, qy.NewQmPlaceholder())
+		assert.NoError(t, err)
+		assert.Equal(t, `((("name" = ?) AND ("age" > ?)) OR ("status" IN (?,?)))`, sb.String())
+		assert.Equal(t, []interface{}{"John", int64(30), "A", "B"}, args)
+	}
+
+	// schema allow-list
+	_, err = qy.NewTree(nil).Schema(testSchema()).ParseRSQL(`name=like=a`)
+	var errs qy.FilterErrors
+	if assert.True(t, errors.As(err, &errs)) {
+		assert.Equal(t, qy.ErrCodeOperatorNotAllowed, errs[0].Code)
+	}
+}
+
+func TestRSQLError(t *testing.T) {
+	tests := []struct {
+		query  string
+		offset int
+	}{
+		{`name==`, 6},
+		{`name`, 4},
+		{`name=foo=1`, 4},
+		{`=gt=1`, 0},
+		{`(a==1`, 5},
+		{`a=in=(1,2`, 9},
+		{`a==1)`, 4},
+		{`a=="x`, 3},
+		{`a==(1,2)`, 1},
+	}
+	for _, test := range tests {
+		_, err := qy.NewTree(nil).ParseRSQL(test.query)
+		var re *qy.RSQLError
+		if assert.True(t, errors.As(err, &re), test.query) {
+			assert.Equal(t, test.offset, re.Offset, test.query)
+		}
+	}
+}
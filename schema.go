@@ -0,0 +1,359 @@
+package squery
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType of filterable field
+type FieldType int
+
+// Supported field types
+const (
+	FieldText FieldType = iota
+	FieldInt
+	FieldDecimal
+	FieldBool
+	FieldTime
+	FieldUUID
+	FieldEnum
+)
+
+// FieldSchema describes single filterable field
+type FieldSchema struct {
+	Type       FieldType
+	Column     string   // SQL expression of the field, quoted field name is used when empty
+	Operators  []string // allowed operators, e.g. $eq, $in. Default operators of the type are used when empty
+	Values     []string // allowed values of FieldEnum
+	TimeLayout string   // layout of FieldTime, default to time.RFC3339
+}
+
+// FilterSchema declares fields which can be used in JSON filter.
+// Values are validated and converted to the field type when the filter is parsed.
+type FilterSchema struct {
+	fields    map[string]*FieldSchema
+	operators Operators
+}
+
+var reUUID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// operators allowed for every field type
+var commonOperators = []string{opEq, opNeq, opIn, opNotIn, opIs, opIsNot, opExists, opDistinct, opNotDistinct}
+
+// operators for ordered type, e.g. number, time
+var orderedOperators = []string{opGt, opGte, opLt, opLte, opBetween}
+
+// operators for text matching
+var textOperators = []string{
+	opLike, opNotLike, opILike, opNotILike,
+	opSimilarTo, opNotSimilarTo,
+	opRegex, opIRegex, opNotRegex, opNotIRegex,
+	opStartsWith, opEndsWith, opContains,
+}
+
+// default operators of each field type
+var typeOperators = map[FieldType][]string{
+	FieldText:    concatStrings(commonOperators, orderedOperators, textOperators),
+	FieldInt:     concatStrings(commonOperators, orderedOperators),
+	FieldDecimal: concatStrings(commonOperators, orderedOperators),
+	FieldTime:    concatStrings(commonOperators, orderedOperators),
+	FieldBool:    commonOperators,
+	FieldUUID:    commonOperators,
+	FieldEnum:    commonOperators,
+}
+
+// NewFilterSchema create empty filter schema
+func NewFilterSchema() *FilterSchema {
+	return &FilterSchema{fields: make(map[string]*FieldSchema)}
+}
+
+// Field declares filterable field
+func (s *FilterSchema) Field(name string, fs FieldSchema) *FilterSchema {
+	s.fields[name] = &fs
+	return s
+}
+
+// RegisterOperator registers custom operator, e.g. $near. The operator is allowed
+// for fields using default operators, other fields must list it in Operators.
+// It panics if op does not start with '$', is built-in operator or fn is nil.
+func (s *FilterSchema) RegisterOperator(op string, fn OperatorFunc) *FilterSchema {
+	if s.operators == nil {
+		s.operators = Operators{}
+	}
+	if err := s.operators.register(op, fn); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Lookup return schema of the field
+func (s *FilterSchema) Lookup(name string) (*FieldSchema, bool) {
+	fs, ok := s.fields[name]
+	return fs, ok
+}
+
+// FieldMapper maps field into its SQL column, default column is quoted for Postgres.
+// Tree using the schema without field mapper quotes default column by its dialect.
+func (s *FilterSchema) FieldMapper(field string) (string, error) {
+	return s.column(field, "", Postgres)
+}
+
+// column return SQL column of the field, default column is the field (qualified by alias, if any)
+// quoted by the dialect
+func (s *FilterSchema) column(field, alias string, d Dialect) (string, error) {
+	fs, ok := s.fields[field]
+	if !ok {
+		return "", errors.New("field " + field + " not found in schema")
+	}
+	if fs.Column == "" && alias != "" {
+		return d.QuoteIdent(alias + "." + field), nil
+	}
+	if fs.Column == "" {
+		return d.QuoteIdent(field), nil
+	}
+	return fs.Column, nil
+}
+
+// validateNode checks and converts values of the node and its children.
+// field is the name of the nearest field term (if any) of the node.
+func (s *FilterSchema) validateNode(nd *treeNode, field string, fs *FieldSchema) FilterErrors {
+	var errs FilterErrors
+	switch {
+	case nd.isRoot || nd.isLogical():
+		for _, child := range nd.Children {
+			errs = append(errs, s.validateNode(child, field, fs)...)
+		}
+	case !nd.isOperator():
+		fs, ok := s.fields[nd.Term]
+		if !ok && nd.hasRelationOperators() {
+			// child fields are mapped by the relation
+			return nil
+		}
+		if !ok {
+			return FilterErrors{newFilterError(nd, ErrCodeUnknownField, "unknown filter field "+nd.Term, nil)}
+		}
+		if len(nd.Children) == 0 {
+			if err := fs.validateValue(nd, opEq); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for _, child := range nd.Children {
+			errs = append(errs, s.validateNode(child, nd.Term, fs)...)
+		}
+	case fs != nil:
+		if err := fs.validateValue(nd, nd.Term); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// allows return true if operator can be used for the field
+func (fs *FieldSchema) allows(op string) bool {
+	ops := fs.Operators
+	if len(ops) == 0 {
+		ops = typeOperators[fs.Type]
+	}
+	for _, item := range ops {
+		if item == op {
+			return true
+		}
+	}
+	return false
+}
+
+// validateValue checks operator and converts value of the node
+func (fs *FieldSchema) validateValue(nd *treeNode, op string) *FilterError {
+	fieldErr := func(msg string) *FilterError {
+		return newFilterError(nd, ErrCodeInvalidValue, msg, nil)
+	}
+	notAllowed := func() *FilterError {
+		return newFilterError(nd, ErrCodeOperatorNotAllowed, "operator "+op+" not allowed", nil)
+	}
+	if nd.custom {
+		// value of custom operator is passed as is to the operator function
+		if len(fs.Operators) > 0 && !fs.allows(op) {
+			return notAllowed()
+		}
+		return nil
+	}
+	if !fs.allows(op) {
+		return notAllowed()
+	}
+	if nd.ValueType == tNull || nd.ValueType == tUnknown {
+		// invalid value has been reported by the parser
+		return nil
+	}
+
+	switch op {
+	case opExists:
+		if _, ok := nd.Value.(bool); !ok {
+			return fieldErr("value must be boolean")
+		}
+	case opIn, opNotIn, opBetween:
+		arr, ok := nd.Value.([]interface{})
+		if !ok {
+			return fieldErr("value must be an array")
+		}
+		values := make([]interface{}, len(arr))
+		for i, item := range arr {
+			if item == nil {
+				continue
+			}
+			v, err := fs.convert(item)
+			if err != nil {
+				return newFilterError(nd, ErrCodeInvalidValue, err.Error(), err)
+			}
+			values[i] = v
+		}
+		nd.Value = values
+	case opIs, opIsNot:
+		// only accept null, true or false
+		if _, ok := nd.Value.(bool); !ok {
+			return fieldErr("value must be null or boolean")
+		}
+	default:
+		if containsString(textOperators, op) {
+			if _, ok := nd.Value.(string); !ok {
+				return fieldErr("value must be string")
+			}
+			return nil
+		}
+		v, err := fs.convert(nd.Value)
+		if err != nil {
+			return newFilterError(nd, ErrCodeInvalidValue, err.Error(), err)
+		}
+		nd.Value = v
+	}
+	return nil
+}
+
+// convert value to the field type
+func (fs *FieldSchema) convert(value interface{}) (interface{}, error) {
+	switch fs.Type {
+	case FieldText:
+		if str, ok := textValue(value); ok {
+			return str, nil
+		}
+		return nil, errors.New("value must be string")
+	case FieldInt:
+		switch v := value.(type) {
+		case json.Number:
+			n, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil {
+				return nil, errors.New("value must be a 64-bit integer")
+			}
+			return n, nil
+		case string:
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, errors.New("value must be an integer")
+			}
+			return n, nil
+		}
+		return nil, errors.New("value must be an integer")
+	case FieldDecimal:
+		// decimal is kept as string, so that the value stays exact
+		switch v := value.(type) {
+		case json.Number:
+			return string(v), nil
+		case string:
+			str := strings.TrimSpace(v)
+			if _, ok := new(big.Float).SetString(str); !ok {
+				return nil, errors.New("value must be a decimal number")
+			}
+			return str, nil
+		}
+		return nil, errors.New("value must be a decimal number")
+	case FieldBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, errors.New("value must be boolean")
+			}
+			return b, nil
+		}
+		return nil, errors.New("value must be boolean")
+	case FieldTime:
+		str, ok := value.(string)
+		if !ok {
+			return nil, errors.New("value must be a time string")
+		}
+		layout := fs.TimeLayout
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		tm, err := time.Parse(layout, strings.TrimSpace(str))
+		if err != nil {
+			return nil, errors.New("value must be a time with layout " + layout)
+		}
+		return tm, nil
+	case FieldUUID:
+		str, ok := value.(string)
+		if !ok || !reUUID.MatchString(str) {
+			return nil, errors.New("value must be an UUID")
+		}
+		return strings.ToLower(str), nil
+	case FieldEnum:
+		str, ok := textValue(value)
+		if !ok || !containsString(fs.Values, str) {
+			return nil, errors.New("value must be one of " + strings.Join(fs.Values, ", "))
+		}
+		return str, nil
+	}
+	return nil, errors.New("unknown field type")
+}
+
+// textValue return literal text of string, number or boolean value,
+// e.g. value of URL query which is decoded as number
+func textValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return string(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// jsonDataType return data type used to cast field stored in JSON column
+func (fs *FieldSchema) jsonDataType() string {
+	switch fs.Type {
+	case FieldInt, FieldDecimal:
+		return JSONNumber
+	case FieldBool:
+		return JSONBoolean
+	case FieldTime:
+		return JSONTimestamp
+	}
+	return JSONText
+}
+
+// containsString return true if str is in the list
+func containsString(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
+
+// concatStrings joins several string slices
+func concatStrings(lists ...[]string) []string {
+	var result []string
+	for _, list := range lists {
+		result = append(result, list...)
+	}
+	return result
+}
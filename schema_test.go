@@ -0,0 +1,90 @@
+package squery_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSchema() *qy.FilterSchema {
+	return qy.NewFilterSchema().
+		Field("id", qy.FieldSchema{Type: qy.FieldUUID, Column: "t.id"}).
+		Field("age", qy.FieldSchema{Type: qy.FieldInt}).
+		Field("price", qy.FieldSchema{Type: qy.FieldDecimal}).
+		Field("active", qy.FieldSchema{Type: qy.FieldBool}).
+		Field("createdAt", qy.FieldSchema{Type: qy.FieldTime, Column: "created_at"}).
+		Field("status", qy.FieldSchema{Type: qy.FieldEnum, Values: []string{"A", "D"}}).
+		Field("name", qy.FieldSchema{Type: qy.FieldText, Operators: []string{"$eq", "$ilike"}})
+}
+
+func TestFilterSchema(t *testing.T) {
+	const filter = `{
+		"id": "9B2F4E1C-3D4A-4F5B-8C6D-7E8F9A0B1C2D",
+		"age": {"$between": [18, "65"]},
+		"price": {"$lt": 10.25},
+		"active": "true",
+		"createdAt": {"$gte": "2021-05-01T00:00:00Z"},
+		"status": {"$in": ["A", null]},
+		"name": {"$ilike": "%putu%"}
+	}`
+	tree, err := qy.NewTree(nil).Schema(testSchema()).Parse([]byte(filter))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sb := strings.Builder{}
+	args, err := tree.Build(&sb, qy.NewPsqlPlaceholder())
+	assert.NoError(t, err)
+	assert.Contains(t, sb.String(), `(t.id = $`)
+	assert.Contains(t, sb.String(), `(created_at >= $`)
+	assert.Contains(t, sb.String(), ` OR "status" IS NULL)`)
+	assert.ElementsMatch(t, []interface{}{
+		"9b2f4e1c-3d4a-4f5b-8c6d-7e8f9a0b1c2d",
+		int64(18), int64(65),
+		"10.25",
+		true,
+		time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		"A",
+		"%putu%",
+	}, args)
+
+	// default column is quoted by dialect of the tree or of the placeholder
+	tree, err = qy.NewTree(nil).Schema(testSchema()).Dialect(qy.MySQL).Parse([]byte(`{"age": 1, "id": "9b2f4e1c-3d4a-4f5b-8c6d-7e8f9a0b1c2d"}`))
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		_, err = tree.Build(&sb, qy.NewQmPlaceholder())
+		assert.NoError(t, err)
+		assert.Equal(t, "((`age` = ?) AND (t.id = ?))", sb.String())
+	}
+	tree, err = qy.NewTree(nil).Schema(testSchema()).Parse([]byte(`{"age": 1}`))
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		_, err = tree.Build(&sb, qy.MySQL.Placeholder())
+		assert.NoError(t, err)
+		assert.Equal(t, "(`age` = ?)", sb.String())
+	}
+}
+
+func TestFilterSchemaErrors(t *testing.T) {
+	invalids := map[string]string{
+		`{"unknown": 1}`:                  "unknown",
+		`{"id": "not-an-uuid"}`:           "id",
+		`{"age": 1.5}`:                    "age",
+		`{"age": {"$like": "1%"}}`:        "age",
+		`{"price": "ten"}`:                "price",
+		`{"active": 1}`:                   "active",
+		`{"createdAt": "yesterday"}`:      "createdAt",
+		`{"status": {"$in": ["A", "X"]}}`: "status",
+		`{"name": {"$neq": "putu"}}`:      "name",
+		`{"$or": [{"age": "old"}]}`:       "age",
+	}
+	for filter, field := range invalids {
+		_, err := qy.NewTree(nil).Schema(testSchema()).Parse([]byte(filter))
+		if assert.Error(t, err, filter) {
+			assert.Contains(t, err.Error(), field, filter)
+		}
+	}
+}
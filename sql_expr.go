@@ -1,5 +1,7 @@
 package squery
 
+import "strings"
+
 // Ensure SQL expression implement Expression interface
 var _ Expression = (*SqlExpression)(nil)
 
@@ -13,16 +15,65 @@ type SqlExpression struct {
 	Fields    []string      `json:"fields"`
 	SqlFields []string      `json:"sqlFields"`
 
-	fm FnMapField
-	ph Placeholder
+	fm        FnMapField
+	tm        FnMapTerm
+	ph        Placeholder
+	jc        JSONColumns
+	schema    *FilterSchema
+	dialect   Dialect
+	relations Relations
+	operators Operators
+	alias     string // qualifies default column of the schema, e.g. alias of relation table
 }
 
-func (se *SqlExpression) mappedField(term string) (string, error) {
+// mappedField maps term into SQL field. For field in JSON column,
+// dataType (or declared type in schema) is used to cast the extracted value.
+// Virtual field of the term mapper is built using placeholder, its arguments are returned.
+func (se *SqlExpression) mappedField(term, dataType string) (string, []interface{}, error) {
+	if len(se.jc) > 0 {
+		if se.schema != nil {
+			if fs, ok := se.schema.Lookup(term); ok {
+				dataType = fs.jsonDataType()
+			}
+		}
+		expr, ok, err := se.jc.Expr(se.sqlDialect(), term, dataType)
+		if ok {
+			return expr, nil, err
+		}
+	}
+	if se.tm != nil {
+		b, err := se.tm(term)
+		if err != nil {
+			return "", nil, err
+		}
+		if b != nil {
+			sb := strings.Builder{}
+			args, err := b.Build(&sb, se.ph)
+			return sb.String(), args, err
+		}
+	}
+	if se.fm == nil && se.schema != nil {
+		sqlField, err := se.schema.column(term, se.alias, se.sqlDialect())
+		return sqlField, nil, err
+	}
 	if se.fm == nil {
-		return term, nil
+		return term, nil, nil
 	}
 
-	return se.fm(term)
+	sqlField, err := se.fm(term)
+	return sqlField, nil, err
+}
+
+// sqlDialect return dialect of the expression. When it is not set, dialect of the placeholder
+// is used, e.g. tree built by template query, default is Postgres.
+func (se *SqlExpression) sqlDialect() Dialect {
+	if se.dialect != nil {
+		return se.dialect
+	}
+	if dp, ok := se.ph.(*dialectPlaceholder); ok {
+		return dp.dialect
+	}
+	return Postgres
 }
 
 // Builder interface, so that it can be passed to query
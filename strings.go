@@ -2,8 +2,6 @@ package squery
 
 import (
 	"io"
-	"strconv"
-	"strings"
 )
 
 // F type for sql field
@@ -39,11 +37,7 @@ func (s S) String() string {
 
 // String representation of the field
 func (f F) String() string {
-	items := strings.Split(string(f), ".")
-	for i := 0; i < len(items); i++ {
-		items[i] = strconv.Quote(items[i])
-	}
-	return strings.Join(items, ".")
+	return quoteIdent(string(f), '"')
 }
 
 func (r R) String() string {
@@ -0,0 +1,138 @@
+package squery
+
+import "strings"
+
+// FnMapTerm maps field into SQL term which may have bound arguments, e.g. virtual field
+// age mapped into Expr.Raw("age_at(?, birth_date)", now). Returning nil term (and nil error)
+// means the field is not a virtual field, and the field mapper is used instead.
+type FnMapTerm func(field string) (Builder, error)
+
+// TermMapper adapts field mapper into term mapper
+func TermMapper(fm FnMapField) FnMapTerm {
+	return func(field string) (Builder, error) {
+		sqlField, err := fm(field)
+		if err != nil {
+			return nil, err
+		}
+		return plainTerm(sqlField), nil
+	}
+}
+
+// BoundTerm is SQL term with bound arguments followed by suffix, e.g. age_at($1, birth_date) DESC.
+// It can be passed as column, ORDER BY or GROUP BY clause of the query.
+type BoundTerm struct {
+	Term   Builder
+	Suffix string
+}
+
+// BoundTerms joins terms with comma
+type BoundTerms []*BoundTerm
+
+// boundStringer is Stringer which must be written using Build
+type boundStringer interface {
+	Builder
+	Stringer
+	bound()
+}
+
+// plainTerm is SQL term without argument
+type plainTerm string
+
+func (p plainTerm) Build(sb StringBuilder, ph Placeholder) ([]interface{}, error) {
+	sb.WriteString(string(p))
+	return nil, nil
+}
+
+func (*BoundTerm) bound() {}
+
+// Build implement Builder interface
+func (t *BoundTerm) Build(sb StringBuilder, ph Placeholder) ([]interface{}, error) {
+	args, err := t.Term.Build(sb, ph)
+	if err != nil {
+		return nil, err
+	}
+	sb.WriteString(t.Suffix)
+	return args, nil
+}
+
+// String return the term with ? placeholder, arguments are discarded
+func (t *BoundTerm) String() string {
+	return boundString(t)
+}
+
+func (BoundTerms) bound() {}
+
+// Build implement Builder interface
+func (ts BoundTerms) Build(sb StringBuilder, ph Placeholder) ([]interface{}, error) {
+	var args []interface{}
+	for i, t := range ts {
+		if i > 0 {
+			sb.WriteByte(bComma)
+		}
+		varg, err := t.Build(sb, ph)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, varg...)
+	}
+	return args, nil
+}
+
+// String return the terms with ? placeholder, arguments are discarded
+func (ts BoundTerms) String() string {
+	return boundString(ts)
+}
+
+// IsEmpty return true if there is no term
+func (ts BoundTerms) IsEmpty() bool {
+	return len(ts) == 0
+}
+
+// boundString builds term using ? placeholder
+func boundString(b Builder) string {
+	sb := strings.Builder{}
+	if _, err := b.Build(&sb, NewQmPlaceholder()); err != nil {
+		return ""
+	}
+	return sb.String()
+}
+
+// writeStringer writes s, bound term is built using placeholder
+func writeStringer(sb StringBuilder, ph Placeholder, s Stringer) ([]interface{}, error) {
+	if b, ok := s.(boundStringer); ok {
+		return b.Build(sb, ph)
+	}
+	writeTerm(sb, ph, s)
+	return nil, nil
+}
+
+// isEmptyStringer return true if s is nil or empty expression, e.g. BoundTerms without term
+func isEmptyStringer(s Stringer) bool {
+	if s == nil {
+		return true
+	}
+	if e, ok := s.(interface{ IsEmpty() bool }); ok {
+		return e.IsEmpty()
+	}
+	return false
+}
+
+// writeColumns writes columns separated by comma, or * if there is no column
+func writeColumns(sb StringBuilder, ph Placeholder, cols []Stringer) ([]interface{}, error) {
+	if len(cols) == 0 {
+		sb.WriteString("*")
+		return nil, nil
+	}
+	var args []interface{}
+	for i, col := range cols {
+		if i > 0 {
+			sb.WriteByte(bComma)
+		}
+		varg, err := writeStringer(sb, ph, col)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, varg...)
+	}
+	return args, nil
+}
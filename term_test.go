@@ -0,0 +1,79 @@
+package squery_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+func ageMapper(field string) (qy.Builder, error) {
+	if field == "age" {
+		return qy.Expr.Raw("age_at(?, birth_date)", "2026-01-01"), nil
+	}
+	return nil, nil
+}
+
+func TestTreeTermMapper(t *testing.T) {
+	fm := func(field string) (string, error) {
+		return `"` + field + `"`, nil
+	}
+	tests := []struct {
+		filter string
+		clause string
+		args   []interface{}
+	}{
+		{
+			`{"age": {"$gt": 18}, "name": "A"}`,
+			`(((age_at($1, birth_date)) > $2) AND ("name" = $3))`,
+			[]interface{}{"2026-01-01", int64(18), "A"},
+		},
+		{
+			`{"age": {"$in": [20, null]}}`,
+			`((age_at($1, birth_date)) IN ($2) OR (age_at($3, birth_date)) IS NULL)`,
+			[]interface{}{"2026-01-01", int64(20), "2026-01-01"},
+		},
+	}
+	for _, test := range tests {
+		tree, err := qy.NewTree(fm).TermMapper(ageMapper).Parse([]byte(test.filter))
+		if !assert.NoError(t, err, test.filter) {
+			continue
+		}
+		sb := strings.Builder{}
+		args, err := tree.Build(&sb, qy.NewPsqlPlaceholder())
+		assert.NoError(t, err, test.filter)
+		assert.Equal(t, test.clause, sb.String(), test.filter)
+		assert.Equal(t, test.args, args, test.filter)
+	}
+}
+
+func TestTemplateListSearchArgTermMapper(t *testing.T) {
+	arg := qy.TemplateListSearchArg{
+		ListSearchArg: qy.ListSearchArg{
+			Filter: json.RawMessage(`{"age": {"$gte": 18}}`),
+			Sorts:  qy.SortConditions{{Fields: []string{"age", "name"}, Order: "desc"}},
+			Fields: []string{"name", "age"},
+		},
+		TermMapper: ageMapper,
+	}
+	tree, err := arg.FilterTree()
+	if !assert.NoError(t, err) {
+		return
+	}
+	search := qy.NewQueryTermExpressionWithMapper(&qy.QueryTerm{Matcher: "LIKE", Term: "%x%"}, []string{"age"}, arg.MapTerm)
+
+	q := qy.NewQuery().From(qy.S("person")).Where(tree).Where(search).OrderBy(arg.OrderBy())
+	sql, args, err := q.Select(arg.FieldsToColumns()...)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT name AS "name",(age_at($1, birth_date)) AS "age" FROM person`+
+		` WHERE (((age_at($2, birth_date)) >= $3)) AND (((age_at($4, birth_date)) LIKE $5))`+
+		` ORDER BY (age_at($6, birth_date)) DESC,name DESC`, sql)
+	assert.Equal(t, []interface{}{"2026-01-01", "2026-01-01", int64(18), "2026-01-01", "%x%", "2026-01-01"}, args)
+
+	// empty ORDER BY is omitted
+	sql, _, err = qy.NewQuery().From(qy.S("person")).OrderBy(qy.SortConditions{}.OrderBy(arg.MapTerm)).Select()
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM person`, sql)
+}
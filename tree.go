@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"io"
+	"math/big"
 	"strconv"
 	"strings"
 )
@@ -21,28 +23,85 @@ const (
 	chAnd            = '$'
 )
 
-// termMap map between field and value (either json/simple data)
-type termMap map[string]json.RawMessage
-
-// Tree stores tree structure of expression
+// Tree stores tree structure of expression.
+// Terms are kept in order of the JSON input, so the same filter always
+// produces byte-identical SQL and arguments.
 type Tree struct {
-	root *treeNode
-	data []byte
-	fm   FnMapField
-	expr *SqlExpression
+	root      *treeNode
+	data      []byte
+	fm        FnMapField
+	tm        FnMapTerm
+	schema    *FilterSchema
+	jc        JSONColumns
+	relations Relations
+	operators Operators
+	customOps Operators // operators of the schema and the tree, merged by Parse
+	dialect   Dialect
+	limits    FilterLimits
+	count     *limitCounter
+	errs      FilterErrors
+	expr      *SqlExpression
 }
 
-// NewExpressionTree create filter tree representation from JSON with default key, i.e. "filter"
+// NewExpressionTree create filter tree representation from JSON with default key, i.e. "filter".
+// The filter is parsed without limits, use NewTree(fm).Limits(DefaultFilterLimits) for filter
+// coming from public API.
 func NewExpressionTree(data []byte, fm FnMapField) (*Tree, error) {
-	tree := &Tree{
-		data: data,
-		fm:   fm,
+	return NewTree(fm).Parse(data)
+}
+
+// NewTree create empty expression tree. Configure the tree, then call Parse, e.g.
+//
+//	tree, err := NewTree(fm).Schema(schema).Limits(DefaultFilterLimits).Parse(data)
+//
+// The tree has no limits unless they are set using Limits.
+func NewTree(fm FnMapField) *Tree {
+	return &Tree{fm: fm}
+}
+
+// Parse JSON filter into the tree. Errors found in the filter are returned
+// as FilterErrors, i.e. every invalid value is reported, not only the first one.
+func (t *Tree) Parse(data []byte) (*Tree, error) {
+	t.data = data
+	t.root = nil
+	t.expr = nil
+	t.errs = nil
+	t.count = &limitCounter{limits: t.limits}
+	t.customOps = t.customOperators()
+	if err := t.parse(); err != nil {
+		var fe *FilterError
+		if !errors.As(err, &fe) {
+			return nil, err
+		}
+		// the tree is incomplete, schema is not validated
+		return nil, append(t.errs, fe)
+	}
+	var opErrs FilterErrors
+	if t.root != nil {
+		opErrs = t.root.validateOperators(nil)
+		t.errs = append(t.errs, opErrs...)
 	}
-	if err := tree.parse(); err != nil {
-		return nil, err
+	if t.root != nil && t.jc != nil {
+		t.errs = append(t.errs, validateJSONFields(t.root, t.jc)...)
+	}
+	if t.root != nil && t.schema != nil && len(opErrs) == 0 {
+		t.errs = append(t.errs, t.schema.validateNode(t.root, "", nil)...)
+	}
+	if t.root != nil && t.relations != nil {
+		// without relations, relation operators can only be evaluated by Match
+		t.errs = append(t.errs, validateRelations(t.root, t.relations)...)
+	}
+	if len(t.errs) > 0 {
+		return nil, t.errs
+	}
+	if t.root == nil {
+		return t, nil
+	}
+	if err := t.root.normalizeNumbers(); err != nil {
+		return nil, FilterErrors{err}
 	}
 
-	return tree, nil
+	return t, nil
 }
 
 // Option set generator option
@@ -51,11 +110,80 @@ func (t *Tree) FieldMapper(fm FnMapField) *Tree {
 	return t
 }
 
+// TermMapper set mapper of virtual fields, i.e. fields mapped into SQL term with bound arguments.
+// Field mapper is used for fields which are not mapped by the term mapper.
+func (t *Tree) TermMapper(tm FnMapTerm) *Tree {
+	t.tm = tm
+	return t
+}
+
+// JSONColumns declares JSON columns, so that field such as `data.address.city`
+// is compiled into property extraction of the column, casted following the value type.
+func (t *Tree) JSONColumns(jc JSONColumns) *Tree {
+	t.jc = jc
+	return t
+}
+
+// Relations declares relations which can be filtered with $some, $none and $every
+func (t *Tree) Relations(r Relations) *Tree {
+	t.relations = r
+	return t
+}
+
+// RegisterOperator registers custom operator of the tree, e.g. $near.
+// It panics if op does not start with '$', is built-in operator or fn is nil.
+func (t *Tree) RegisterOperator(op string, fn OperatorFunc) *Tree {
+	if t.operators == nil {
+		t.operators = Operators{}
+	}
+	if err := t.operators.register(op, fn); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// customOperators return custom operators of the schema and the tree
+func (t *Tree) customOperators() Operators {
+	if t.schema == nil {
+		return t.operators
+	}
+	return t.schema.operators.merge(t.operators)
+}
+
+// Dialect set dialect used to generate JSON property extraction. Default is Postgres.
+func (t *Tree) Dialect(d Dialect) *Tree {
+	t.dialect = d
+	return t
+}
+
+// Limits set complexity limits checked during Parse.
+// When the filter exceeds a limit, Parse returns *LimitError.
+func (t *Tree) Limits(l FilterLimits) *Tree {
+	t.limits = l
+	return t
+}
+
+// Schema set filter schema used to validate and convert values during Parse.
+// When field mapper is not set, schema is also used to map the fields.
+func (t *Tree) Schema(s *FilterSchema) *Tree {
+	t.schema = s
+	return t
+}
+
 // Build implement builder interface
 func (t *Tree) Build(sb StringBuilder, ph Placeholder) ([]interface{}, error) {
 	// parse if the tree is not empty
 	if !t.IsEmpty() {
-		expr, err := t.root.build(sb, ph, t.fm)
+		expr, err := t.root.build(sb, &SqlExpression{
+			ph:        ph,
+			fm:        t.fm,
+			tm:        t.tm,
+			jc:        t.jc,
+			schema:    t.schema,
+			dialect:   t.dialect,
+			relations: t.relations,
+			operators: t.customOps,
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -80,148 +208,249 @@ func (t *Tree) SqlExpression() *SqlExpression {
 	return t.expr
 }
 
-// parse JSON data to tree
+// parse JSON data to tree. The tree is built in a single pass using token level decoder.
+// Invalid values are collected in errs, syntax error and exceeded limit stop the parsing.
 func (t *Tree) parse() error {
-	// clean up data
-	nd := len(t.data)
-	if nd == 0 {
+	if len(bytes.TrimSpace(t.data)) == 0 {
 		return nil
 	}
 
-	i := 0
-	for i < nd {
-		switch t.data[i] {
-		case '\t', '\r', '\n', '\v', ' ':
-			i++
-		default:
-			goto clean
-		}
-	}
-clean:
-	rootNode := treeNode{
-		Data:   t.data[i:],
-		isRoot: true,
-	}
-	err := t.parseToNode(&rootNode)
-	if err != nil {
+	dec := json.NewDecoder(bytes.NewReader(t.data))
+	dec.UseNumber()
+	rootNode := treeNode{isRoot: true, path: "$"}
+	if err := t.parseToNode(dec, &rootNode, 0); err != nil {
 		return err
 	}
+	if _, err := dec.Token(); err != io.EOF {
+		return newFilterError(&rootNode, ErrCodeSyntax, "unexpected data after JSON filter", err)
+	}
 	t.root = &rootNode
 	return nil
 }
 
-func (t *Tree) parseToNode(nd *treeNode) error {
-	if len(nd.Data) == 0 {
-		//return errors.New("empty value")
-		return nil
+// addError collects non fatal error of the node
+func (t *Tree) addError(nd *treeNode, code, msg string) {
+	t.errs = append(t.errs, newFilterError(nd, code, msg, nil))
+}
+
+// parseToNode decodes next value of the decoder into the node
+func (t *Tree) parseToNode(dec *json.Decoder, nd *treeNode, depth int) error {
+	// custom operator accepts any JSON value
+	if _, ok := t.customOps.lookup(nd.Term); ok {
+		elems := 0
+		v, err := t.decodeValue(dec, nd, depth, &elems)
+		if err != nil {
+			return err
+		}
+		if nd.Value, err = normalizeValue(v); err != nil {
+			t.addError(nd, ErrCodeInvalidValue, err.Error())
+			return nil
+		}
+		nd.custom = true
+		return wrapFilterError(nd, ErrCodeLimitExceeded, t.count.addValue(nd))
 	}
 
-	// create operator
-	switch nd.Data[0] {
-	case leftBrace:
-		// object, AND operation
-		tmAnd := termMap{}
-		if err := json.Unmarshal(nd.Data, &tmAnd); err != nil {
+	switch nd.Term {
+	case opBetween, opIn, opNotIn:
+		tok, err := dec.Token()
+		if err != nil {
+			return wrapFilterError(nd, ErrCodeSyntax, err)
+		}
+		if delim, ok := tok.(json.Delim); !ok {
+			return t.setScalar(nd, tok)
+		} else if delim != leftBracket {
+			return newFilterError(nd, ErrCodeInvalidValue, nd.Term+" operator needs array of scalar values", nil)
+		}
+		arr, err := t.decodeList(dec, nd)
+		if err != nil {
 			return err
 		}
+		nd.Value = arr
+		nd.ValueType = tArray
+		if nd.Term == opBetween {
+			nd.ValueType = tArrayBetween
+			if len(arr) != 2 {
+				t.addError(nd, ErrCodeInvalidValue, "$between operator needs array args with 2 values")
+				return nil
+			}
+		}
+		return wrapFilterError(nd, ErrCodeLimitExceeded, t.count.addValue(nd))
+	}
 
-		// loop through term
-		nd.Value = opAnd
+	tok, err := dec.Token()
+	if err != nil {
+		return wrapFilterError(nd, ErrCodeSyntax, err)
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		// object is AND operation, array of objects is OR operation
+		if err := t.count.depth(depth + 1); err != nil {
+			return wrapFilterError(nd, ErrCodeLimitExceeded, err)
+		}
 		nd.ValueType = tOperator
-		for key, val := range tmAnd {
-			term := strings.TrimSpace(key)
-			if term == "" {
-				continue
-			}
-			childNode := treeNode{
-				Term: term,
-				Data: []byte(val),
-			}
-			nd.Children = append(nd.Children, &childNode)
-			if err := t.parseToNode(&childNode); err != nil {
-				return err
-			}
+		if v == leftBrace {
+			nd.Value = opAnd
+			return t.parseTerms(dec, nd, nd.path, depth)
 		}
-	case leftBracket:
-		switch nd.Term {
-		case opBetween:
-			var arr []interface{}
-			if err := json.Unmarshal(nd.Data, &arr); err != nil {
-				return err
+		nd.Value = opOr
+		for i := 0; dec.More(); i++ {
+			tok, err := dec.Token()
+			if err != nil {
+				return wrapFilterError(nd, ErrCodeSyntax, err)
 			}
-			if len(arr) != 2 {
-				return errors.New("$between operator needs array args with 2 values")
+			prefix := nd.path + "[" + strconv.Itoa(i) + "]"
+			if delim, ok := tok.(json.Delim); !ok || delim != leftBrace {
+				return &FilterError{Path: prefix, Term: nd.Term, Code: ErrCodeSyntax, Message: "filter term must be a JSON object"}
 			}
-			nd.Value = arr
-			nd.ValueType = tArrayBetween
-			return nil
-		case opIn, opNotIn:
-			var arr []interface{}
-			if err := json.Unmarshal(nd.Data, &arr); err != nil {
+			if err := t.parseTerms(dec, nd, prefix, depth); err != nil {
 				return err
 			}
-			nd.Value = arr
-			nd.ValueType = tArray
+		}
+		_, err := dec.Token()
+		return wrapFilterError(nd, ErrCodeSyntax, err)
+	default:
+		if nd.isLogicalTerm() {
+			t.addError(nd, ErrCodeInvalidValue, nd.Term+" operator needs object or array value")
 			return nil
-		default:
-			// array, OR operation
-			// object, AND operation
-			tmOr := []termMap{}
-			if err := json.Unmarshal(nd.Data, &tmOr); err != nil {
-				return err
-			}
-
-			// loop through term
-			nd.Value = opOr
-			nd.ValueType = tOperator
-			for _, item := range tmOr {
-				for key, val := range item {
-					term := strings.TrimSpace(key)
-					if term == "" {
-						continue
-					}
-					childNode := treeNode{
-						Term: term,
-						Data: []byte(val),
-					}
-					nd.Children = append(nd.Children, &childNode)
-					if err := t.parseToNode(&childNode); err != nil {
-						return err
-					}
-				}
-			}
 		}
+		return t.setScalar(nd, v)
+	}
+}
 
-	case doubleQuote:
-		// string data
-		str, err := strconv.Unquote(string(nd.Data))
+// parseTerms decodes terms of JSON object into children of the node,
+// in order of appearance. Opening brace must have been consumed.
+// prefix is JSON path of the object.
+func (t *Tree) parseTerms(dec *json.Decoder, nd *treeNode, prefix string, depth int) error {
+	for dec.More() {
+		tok, err := dec.Token()
 		if err != nil {
+			return wrapFilterError(nd, ErrCodeSyntax, err)
+		}
+		key, _ := tok.(string)
+		term := strings.TrimSpace(key)
+		if term == "" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return wrapFilterError(nd, ErrCodeSyntax, err)
+			}
+			continue
+		}
+		childNode := &treeNode{Term: term, path: prefix + "." + term}
+		nd.Children = append(nd.Children, childNode)
+		if err := t.count.addNode(); err != nil {
+			return wrapFilterError(childNode, ErrCodeLimitExceeded, err)
+		}
+		if err := t.parseToNode(dec, childNode, depth+1); err != nil {
 			return err
 		}
-		nd.Value = str
+	}
+	_, err := dec.Token()
+	return wrapFilterError(nd, ErrCodeSyntax, err)
+}
+
+// setScalar set scalar value of the node, numbers are kept exact
+// until converted by schema or numberValue
+func (t *Tree) setScalar(nd *treeNode, v interface{}) error {
+	switch v.(type) {
+	case nil:
+		nd.ValueType = tNull
+	case bool:
+		nd.ValueType = tBoolean
+	case string:
 		nd.ValueType = tString
-		return nil
+	case json.Number:
+		nd.ValueType = tNumber
 	default:
-		data := nd.Data
-		if bytes.Equal(vNull, data) {
-			nd.Value = nil
-			nd.ValueType = tNull
-		} else if bytes.Equal(vTrue, data) {
-			nd.Value = true
-			nd.ValueType = tBoolean
-		} else if bytes.Equal(vFalse, data) {
-			nd.Value = false
-			nd.ValueType = tBoolean
-		} else {
-			// perhaps a number
-			fv, err := strconv.ParseFloat(string(data), 64)
+		t.addError(nd, ErrCodeInvalidValue, "unexpected value of "+nd.Term)
+		return nil
+	}
+	nd.Value = v
+	return wrapFilterError(nd, ErrCodeLimitExceeded, t.count.addValue(nd))
+}
+
+// decodeList decodes scalar elements of $in, $nin and $between, opening bracket must have
+// been consumed. Limits are checked for every element, before the rest of the array is read.
+func (t *Tree) decodeList(dec *json.Decoder, nd *treeNode) ([]interface{}, error) {
+	arr := []interface{}{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, wrapFilterError(nd, ErrCodeSyntax, err)
+		}
+		if _, ok := tok.(json.Delim); ok {
+			return nil, newFilterError(nd, ErrCodeInvalidValue, nd.Term+" operator needs array of scalar values", nil)
+		}
+		arr = append(arr, tok)
+		if err := t.count.element(nd.Term != opBetween, len(arr), tok); err != nil {
+			return nil, wrapFilterError(nd, ErrCodeLimitExceeded, err)
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, wrapFilterError(nd, ErrCodeSyntax, err)
+	}
+	return arr, nil
+}
+
+// decodeValue decodes any JSON value token by token, numbers are decoded as json.Number.
+// Nesting level, length of arrays and strings, and number of elements are checked while decoding.
+func (t *Tree) decodeValue(dec *json.Decoder, nd *treeNode, depth int, elems *int) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, wrapFilterError(nd, ErrCodeSyntax, err)
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		*elems++
+		return tok, wrapFilterError(nd, ErrCodeLimitExceeded, t.count.element(false, *elems, tok))
+	}
+	if err := t.count.depth(depth + 1); err != nil {
+		return nil, wrapFilterError(nd, ErrCodeLimitExceeded, err)
+	}
+
+	var v interface{}
+	if delim == leftBracket {
+		arr := []interface{}{}
+		for dec.More() {
+			item, err := t.decodeValue(dec, nd, depth+1, elems)
 			if err != nil {
-				return err
+				return nil, err
+			}
+			arr = append(arr, item)
+			if err := t.count.check("MaxInLength", t.count.limits.MaxInLength, len(arr)); err != nil {
+				return nil, wrapFilterError(nd, ErrCodeLimitExceeded, err)
 			}
-			nd.Value = fv
-			nd.ValueType = tNumber
 		}
-		return nil
+		v = arr
+	} else {
+		obj := make(map[string]interface{})
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, wrapFilterError(nd, ErrCodeSyntax, err)
+			}
+			item, err := t.decodeValue(dec, nd, depth+1, elems)
+			if err != nil {
+				return nil, err
+			}
+			obj[key.(string)] = item
+		}
+		v = obj
 	}
-	return nil
+	if _, err := dec.Token(); err != nil {
+		return nil, wrapFilterError(nd, ErrCodeSyntax, err)
+	}
+	return v, nil
+}
+
+// numberValue converts JSON number into int64 if it is an integer,
+// decimal string if the integer does not fit into int64, otherwise float64.
+func numberValue(num json.Number) (interface{}, error) {
+	str := string(num)
+	if n, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return n, nil
+	}
+	if _, ok := new(big.Int).SetString(str, 10); ok {
+		return str, nil
+	}
+	return strconv.ParseFloat(str, 64)
 }
@@ -1,31 +1,41 @@
 package squery
 
 import (
+	"encoding/json"
 	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 )
 
 // stores treenode
 type treeNode struct {
 	Term      string      `json:"term"`
-	Data      []byte      `json:"-"`
 	Value     interface{} `json:"value"`
 	ValueType valueType   `json:"valueType"`
 	Children  []*treeNode `json:"children"`
 
 	isRoot bool
+	path   string // JSON path of the node, e.g. $.$or[2].age
+	custom bool   // value of custom operator
+	re     nodeRegexp
 }
 
-func (fn *treeNode) build(sb StringBuilder, ph Placeholder, fm FnMapField) (*SqlExpression, error) {
-	whereArg := SqlExpression{
-		ph: ph,
-		fm: fm,
-	}
-	err := fn.traverseNode(sb, &whereArg)
+// nodeRegexp is regular expression of the node compiled once by Match
+type nodeRegexp struct {
+	once sync.Once
+	re   *regexp.Regexp
+	err  error
+}
+
+func (fn *treeNode) build(sb StringBuilder, whereArg *SqlExpression) (*SqlExpression, error) {
+	err := fn.traverseNode(sb, whereArg)
 	if err != nil {
 		return nil, err
 	}
 
-	return &whereArg, nil
+	return whereArg, nil
 }
 
 func (fn *treeNode) operatorString(op string) bool {
@@ -35,83 +45,339 @@ func (fn *treeNode) operatorString(op string) bool {
 	return op[0] == chAnd
 }
 
+// normalizeNumbers converts remaining json.Number values of the node and its children
+func (fn *treeNode) normalizeNumbers() *FilterError {
+	var err error
+	switch v := fn.Value.(type) {
+	case json.Number:
+		if fn.Value, err = numberValue(v); err != nil {
+			return newFilterError(fn, ErrCodeInvalidValue, err.Error(), err)
+		}
+	case []interface{}:
+		for i, item := range v {
+			if num, ok := item.(json.Number); ok {
+				if v[i], err = numberValue(num); err != nil {
+					return newFilterError(fn, ErrCodeInvalidValue, err.Error(), err)
+				}
+			}
+		}
+	}
+	for _, child := range fn.Children {
+		if err := child.normalizeNumbers(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateOperators checks that operators are known and applied to a field with valid value,
+// so that malformed filter is rejected by Parse instead of Build. field is the nearest field term.
+func (fn *treeNode) validateOperators(field *treeNode) FilterErrors {
+	var errs FilterErrors
+	switch {
+	case fn.isRoot || fn.isLogical():
+		for _, child := range fn.Children {
+			errs = append(errs, child.validateOperators(field)...)
+		}
+		return errs
+	case fn.isLogicalTerm():
+		// scalar value of logical operator has been reported by the parser
+		return nil
+	case !fn.isOperator():
+		if field != nil {
+			return FilterErrors{newFilterError(fn, ErrCodeSyntax, "nested field "+fn.Term+" of "+field.Term+" is not supported", nil)}
+		}
+		for _, child := range fn.Children {
+			errs = append(errs, child.validateOperators(fn)...)
+		}
+		return errs
+	case field == nil:
+		return FilterErrors{newFilterError(fn, ErrCodeSyntax, fn.Term+" operator must be applied to a field", nil)}
+	case isRelationOperator(fn.Term):
+		// fields of the child table are not nested in the parent field
+		for _, child := range fn.Children {
+			errs = append(errs, child.validateOperators(nil)...)
+		}
+		return errs
+	case fn.custom:
+		return nil
+	}
+
+	if _, ok := opToSQL[fn.Term]; !ok {
+		return FilterErrors{newFilterError(fn, ErrCodeUnknownOperator, "unknown operator "+fn.Term, nil)}
+	}
+	if len(fn.Children) > 0 {
+		return FilterErrors{newFilterError(fn, ErrCodeInvalidValue, fn.Term+" operator does not accept object value", nil)}
+	}
+	switch fn.Term {
+	case opExists:
+		if fn.ValueType != tBoolean {
+			return FilterErrors{newFilterError(fn, ErrCodeInvalidValue, fn.Term+" operator needs boolean value", nil)}
+		}
+	case opStartsWith, opEndsWith, opContains:
+		if fn.ValueType != tString {
+			return FilterErrors{newFilterError(fn, ErrCodeInvalidValue, fn.Term+" operator needs string value", nil)}
+		}
+	}
+	return nil
+}
+
+// jsonDataType return data type used to cast JSON field compared with value of the node
+func (fn *treeNode) jsonDataType() string {
+	if containsString(textOperators, fn.Term) {
+		return JSONText
+	}
+	value := fn.Value
+	if arr, ok := value.([]interface{}); ok {
+		value = nil
+		for _, item := range arr {
+			if item != nil {
+				value = item
+				break
+			}
+		}
+	}
+	switch value.(type) {
+	case bool:
+		return JSONBoolean
+	case int64, float64, json.Number:
+		return JSONNumber
+	case time.Time:
+		return JSONTimestamp
+	}
+	return ""
+}
+
 // isOperator return true if term start with '$'
 func (fn *treeNode) isOperator() bool {
 	return fn.operatorString(fn.Term)
 }
 
 func (fn *treeNode) isOr() bool {
-	return fn.Term == opOr
+	return fn.Term == opOr || fn.Term == opNor
+}
+
+// isLogicalTerm return true if term of the node is $and, $or, $nor or $not
+func (fn *treeNode) isLogicalTerm() bool {
+	switch fn.Term {
+	case opAnd, opOr, opNor, opNot:
+		return true
+	}
+	return false
+}
+
+// isLogical return true if node combines its children, i.e. $and, $or, $nor or $not
+func (fn *treeNode) isLogical() bool {
+	return fn.isLogicalTerm() && len(fn.Children) > 0
+}
+
+// isNegation return true for $not and $nor
+func (fn *treeNode) isNegation() bool {
+	return fn.Term == opNot || fn.Term == opNor
 }
 
 func (fn *treeNode) traverseNode(sb StringBuilder, arg *SqlExpression) error {
-	// number of children
-	nchildren := len(fn.Children)
-	switch nchildren {
-	case 0:
-		sb.WriteByte(bLParenthesis)
-		fn.writeLeaf(sb, arg)
-		sb.WriteByte(bRParenthesis)
-	case 1:
-		if fn.isRoot {
-			fn.Children[0].traverseNode(sb, arg)
-		} else {
-			sb.WriteByte(bLParenthesis)
-			if err := fn.tryWriteTerm(sb, arg); err != nil {
-				return err
-			}
-			if err := fn.tryWriteOperator(sb); err != nil {
-				return err
-			}
-			fn.Children[0].writeLeaf(sb, arg)
-			sb.WriteByte(bRParenthesis)
+	return fn.writeNode(sb, arg, nil)
+}
+
+// writeNode writes node and its children. field is the nearest field term
+// of the node, operators are applied to the field.
+func (fn *treeNode) writeNode(sb StringBuilder, arg *SqlExpression, field *treeNode) error {
+	switch {
+	case fn.isRoot:
+		if len(fn.Children) == 1 {
+			return fn.Children[0].writeNode(sb, arg, field)
 		}
-	default:
-		sb.WriteByte(bLParenthesis)
-		op := opToSQL[opAnd]
-		if fn.isOr() {
-			op = opToSQL[opOr]
+		op := sqlAnd
+		if fn.Value == opOr {
+			op = sqlOr
 		}
-
-		if err := fn.Children[0].traverseNode(sb, arg); err != nil {
-			return err
+		return fn.writeChildren(sb, arg, field, op)
+	case fn.isLogical():
+		return fn.writeGroup(sb, arg, field)
+	case !fn.isOperator():
+		if field != nil {
+			return errors.New(field.Term + ": nested field " + fn.Term + " is not supported")
+		}
+		switch len(fn.Children) {
+		case 0:
+			return fn.writeEq(sb, arg)
+		case 1:
+			return fn.Children[0].writeNode(sb, arg, fn)
 		}
-		for i := 1; i < nchildren; i++ {
+		// several operators of the same field, e.g. {"age": {"$gt": 18, "$lt": 65}},
+		// array of operators is OR operation, e.g. {"age": [{"$lt": 18}, {"$gt": 65}]}
+		if fn.Value == opOr {
+			return fn.writeChildren(sb, arg, fn, sqlOr)
+		}
+		return fn.writeChildren(sb, arg, fn, sqlAnd)
+	}
+
+	if field == nil {
+		return errors.New(fn.Term + ": operator must be applied to a field")
+	}
+	if isRelationOperator(fn.Term) {
+		return fn.writeRelation(sb, arg, field)
+	}
+	if opFn, ok := arg.operators.lookup(fn.Term); ok && fn.custom {
+		return fn.writeCustomOperation(sb, arg, field, opFn)
+	}
+	if len(fn.Children) > 0 {
+		return errors.New(field.Term + ": " + fn.Term + " operator does not accept object value")
+	}
+	return fn.writeOperation(sb, arg, field)
+}
+
+// writeChildren writes children joined with op, e.g. ((a = $1) AND (b = $2))
+func (fn *treeNode) writeChildren(sb StringBuilder, arg *SqlExpression, field *treeNode, op string) error {
+	sb.WriteByte(bLParenthesis)
+	for i, child := range fn.Children {
+		if i > 0 {
 			sb.WriteByte(bSpace)
 			sb.WriteString(op)
 			sb.WriteByte(bSpace)
-			if err := fn.Children[i].traverseNode(sb, arg); err != nil {
-				return err
-			}
 		}
-		sb.WriteByte(bRParenthesis)
+		if err := child.writeNode(sb, arg, field); err != nil {
+			return err
+		}
 	}
+	sb.WriteByte(bRParenthesis)
 
 	return nil
 }
 
-// writeLeaf node, i.e. node that don't has any children
-func (fn *treeNode) writeLeaf(sb StringBuilder, arg *SqlExpression) error {
-	if fn.isOperator() {
-		if err := fn.tryWriteOperator(sb); err != nil {
+// writeGroup writes children of logical node, e.g. (NOT ((a = $1) OR (b = $2)))
+func (fn *treeNode) writeGroup(sb StringBuilder, arg *SqlExpression, field *treeNode) error {
+	op := opToSQL[opAnd]
+	if fn.isOr() {
+		op = opToSQL[opOr]
+	}
+	if !fn.isNegation() {
+		if len(fn.Children) == 1 {
+			sb.WriteByte(bLParenthesis)
+			err := fn.Children[0].writeNode(sb, arg, field)
+			sb.WriteByte(bRParenthesis)
 			return err
 		}
+		return fn.writeChildren(sb, arg, field, op)
+	}
+
+	sb.WriteByte(bLParenthesis)
+	sb.WriteString(sqlNot)
+	sb.WriteByte(bSpace)
+	var err error
+	if len(fn.Children) == 1 {
+		err = fn.Children[0].writeNode(sb, arg, field)
+	} else {
+		err = fn.writeChildren(sb, arg, field, op)
+	}
+	sb.WriteByte(bRParenthesis)
+
+	return err
+}
+
+// mapField return mapped SQL field, dataType is used to cast field in JSON column
+func (fn *treeNode) mapField(arg *SqlExpression, dataType string) (string, error) {
+	sqlField, args, err := arg.mappedField(fn.Term, dataType)
+	if err != nil {
+		return "", err
+	}
+	arg.Args = append(arg.Args, args...)
+	arg.Fields = append(arg.Fields, fn.Term)
+	arg.SqlFields = append(arg.SqlFields, sqlField)
+
+	return sqlField, nil
+}
+
+// writeField writes mapped SQL field
+func (fn *treeNode) writeField(sb StringBuilder, arg *SqlExpression, dataType string) error {
+	sqlField, err := fn.mapField(arg, dataType)
+	if err != nil {
+		return err
+	}
+	sb.WriteString(sqlField)
+
+	return nil
+}
+
+// writeEq writes field with simple value, e.g. (name = $1) or (name IS NULL)
+func (fn *treeNode) writeEq(sb StringBuilder, arg *SqlExpression) error {
+	sb.WriteByte(bLParenthesis)
+	if err := fn.writeField(sb, arg, fn.jsonDataType()); err != nil {
+		return err
+	}
+	op := opToSQL[opEq]
+	if fn.ValueType == tNull {
+		op = opToSQL[opIs]
+	}
+	sb.WriteByte(bSpace)
+	sb.WriteString(op)
+	sb.WriteByte(bSpace)
+	if err := fn.writeValue(sb, arg); err != nil {
+		return err
+	}
+	sb.WriteByte(bRParenthesis)
+
+	return nil
+}
+
+// writeOperation writes operator node applied to the field, e.g. (age > $1)
+func (fn *treeNode) writeOperation(sb StringBuilder, arg *SqlExpression, field *treeNode) error {
+	op, ok := opToSQL[fn.Term]
+	if !ok {
+		return errors.New(fn.Term + ": unknown operator")
+	}
+
+	sqlField, err := field.mapField(arg, fn.jsonDataType())
+	if err != nil {
+		return err
+	}
+	switch fn.Term {
+	case opIn, opNotIn:
+		return fn.writeInList(sb, arg, field, sqlField)
+	case opDistinct, opNotDistinct:
+		return fn.writeDistinctFrom(sb, arg, sqlField)
+	}
+
+	sb.WriteByte(bLParenthesis)
+	sb.WriteString(sqlField)
+	switch fn.Term {
+	case opEq, opNeq:
+		// comparing with NULL never matches, use IS [NOT] NULL instead
+		if fn.ValueType == tNull {
+			sb.WriteByte(bSpace)
+			if fn.Term == opEq {
+				sb.WriteString(sqlIsNull)
+			} else {
+				sb.WriteString(sqlIsNotNull)
+			}
+			break
+		}
+		sb.WriteByte(bSpace)
+		sb.WriteString(op)
+		sb.WriteByte(bSpace)
 		if err := fn.writeValue(sb, arg); err != nil {
 			return err
 		}
-	} else {
-		sqlField, err := arg.mappedField(fn.Term)
-		if err != nil {
+	case opExists:
+		if err := fn.writeExists(sb); err != nil {
 			return err
 		}
-		arg.Fields = append(arg.Fields, fn.Term)
-		arg.SqlFields = append(arg.SqlFields, sqlField)
-
-		sb.WriteString(sqlField)
-		op := opToSQL[opEq]
-		if fn.ValueType == tNull {
-			op = opToSQL[opIs]
+	case opStartsWith, opEndsWith, opContains:
+		if err := fn.writeLikePattern(sb, arg); err != nil {
+			return err
+		}
+		arg.sqlDialect().WriteLikeEscape(sb)
+	case opLike, opNotLike, opILike, opNotILike:
+		// backslash is escape character in every dialect, e.g. pattern of RSQL and OData
+		sb.WriteByte(bSpace)
+		sb.WriteString(op)
+		sb.WriteByte(bSpace)
+		if err := fn.writeValue(sb, arg); err != nil {
+			return err
 		}
+		arg.sqlDialect().WriteLikeEscape(sb)
+	default:
 		sb.WriteByte(bSpace)
 		sb.WriteString(op)
 		sb.WriteByte(bSpace)
@@ -119,41 +385,162 @@ func (fn *treeNode) writeLeaf(sb StringBuilder, arg *SqlExpression) error {
 			return err
 		}
 	}
+	sb.WriteByte(bRParenthesis)
+
 	return nil
 }
 
-// try to write operator if term is operator
-func (fn *treeNode) tryWriteOperator(sb StringBuilder) error {
-	if fn.isOperator() {
-		op, ok := opToSQL[fn.Term]
-		if !ok {
-			return errors.New(fn.Term + ": unknown operator")
+// writeInList writes $in and $nin. NULL in the list is written as separate condition,
+// e.g. (age IN ($1,$2) OR age IS NULL), since IN never matches NULL.
+// Empty list is written as always false ($in) or always true ($nin) condition.
+func (fn *treeNode) writeInList(sb StringBuilder, arg *SqlExpression, field *treeNode, sqlField string) error {
+	values, ok := fn.Value.([]interface{})
+	if !ok {
+		return errors.New(fn.Term + " operator needs array value")
+	}
+	hasNull := false
+	var args []interface{}
+	for _, v := range values {
+		if v == nil {
+			hasNull = true
+		} else {
+			args = append(args, v)
+		}
+	}
+
+	isIn := fn.Term == opIn
+	sb.WriteByte(bLParenthesis)
+	switch {
+	case len(args) == 0 && !hasNull:
+		if isIn {
+			sb.WriteString("1=0")
+		} else {
+			sb.WriteString("1=1")
 		}
+	case len(args) == 0:
+		sb.WriteString(sqlField)
 		sb.WriteByte(bSpace)
-		sb.WriteString(op)
+		if isIn {
+			sb.WriteString(sqlIsNull)
+		} else {
+			sb.WriteString(sqlIsNotNull)
+		}
+	default:
+		sb.WriteString(sqlField)
+		sb.WriteByte(bSpace)
+		sb.WriteString(opToSQL[fn.Term])
 		sb.WriteByte(bSpace)
+		sb.WriteByte(bLParenthesis)
+		for i := range args {
+			if i > 0 {
+				sb.WriteByte(bComma)
+			}
+			sb.WriteString(arg.ph.Next())
+		}
+		sb.WriteByte(bRParenthesis)
+		arg.Args = append(arg.Args, args...)
+
+		if hasNull {
+			// map the field again, so that placeholders of virtual field are not reused
+			sqlField, args, err := arg.mappedField(field.Term, fn.jsonDataType())
+			if err != nil {
+				return err
+			}
+			arg.Args = append(arg.Args, args...)
+			if isIn {
+				sb.WriteString(" OR ")
+				sb.WriteString(sqlField)
+				sb.WriteByte(bSpace)
+				sb.WriteString(sqlIsNull)
+			} else {
+				sb.WriteString(" AND ")
+				sb.WriteString(sqlField)
+				sb.WriteByte(bSpace)
+				sb.WriteString(sqlIsNotNull)
+			}
+		}
 	}
+	sb.WriteByte(bRParenthesis)
+
 	return nil
 }
 
-// try to write term if the term is not operator
-func (fn *treeNode) tryWriteTerm(sb StringBuilder, arg *SqlExpression) error {
-	if fn.isRoot {
-		return nil
+// writeDistinctFrom writes NULL-safe comparison, e.g. (age IS DISTINCT FROM $1)
+func (fn *treeNode) writeDistinctFrom(sb StringBuilder, arg *SqlExpression, sqlField string) error {
+	if fn.ValueType == tArray || fn.ValueType == tArrayBetween || len(fn.Children) > 0 {
+		return errors.New(fn.Term + " operator needs scalar value")
 	}
-	if !fn.isOperator() {
-		sqlField, err := arg.mappedField(fn.Term)
-		if err != nil {
-			return err
-		}
-		arg.Fields = append(arg.Fields, fn.Term)
-		arg.SqlFields = append(arg.SqlFields, sqlField)
+	value := "NULL"
+	if fn.ValueType != tNull {
+		value = arg.ph.Next()
+		arg.Args = append(arg.Args, fn.Value)
+	}
+	sb.WriteByte(bLParenthesis)
+	arg.sqlDialect().WriteDistinctFrom(sb, sqlField, value, fn.Term == opDistinct)
+	sb.WriteByte(bRParenthesis)
 
-		sb.WriteString(sqlField)
+	return nil
+}
+
+// writeExists writes IS NULL or IS NOT NULL for $exists operator
+func (fn *treeNode) writeExists(sb StringBuilder) error {
+	exists, ok := fn.Value.(bool)
+	if !ok {
+		return errors.New(fn.Term + " operator needs boolean value")
+	}
+	sb.WriteByte(bSpace)
+	if exists {
+		sb.WriteString(sqlIsNotNull)
+	} else {
+		sb.WriteString(sqlIsNull)
+	}
+	return nil
+}
+
+// writeLikePattern writes LIKE for $startsWith, $endsWith and $contains.
+// Wildcard characters in the value are escaped, so that they are matched literally.
+func (fn *treeNode) writeLikePattern(sb StringBuilder, arg *SqlExpression) error {
+	str, ok := fn.Value.(string)
+	if !ok {
+		return errors.New(fn.Term + " operator needs string value")
+	}
+	pattern := escapeLike(str)
+	switch fn.Term {
+	case opStartsWith:
+		pattern = pattern + "%"
+	case opEndsWith:
+		pattern = "%" + pattern
+	default:
+		pattern = "%" + pattern + "%"
 	}
+
+	sb.WriteByte(bSpace)
+	sb.WriteString(opToSQL[fn.Term])
+	sb.WriteByte(bSpace)
+	sb.WriteString(arg.ph.Next())
+	arg.Args = append(arg.Args, pattern)
+
 	return nil
 }
 
+// escapeLike escapes LIKE wildcards (%, _) and the escape character (\) declared by WriteLikeEscape
+func escapeLike(str string) string {
+	if !strings.ContainsAny(str, `\%_`) {
+		return str
+	}
+	sb := strings.Builder{}
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; c {
+		case bBackslash, bPercent, bUnderscore:
+			sb.WriteByte(bBackslash)
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
 // write value section of the node
 func (fn *treeNode) writeValue(sb StringBuilder, arg *SqlExpression) error {
 	switch fn.ValueType {
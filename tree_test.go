@@ -1,6 +1,7 @@
 package squery_test
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -98,25 +99,339 @@ func TestParser(t *testing.T) {
 }
 
 func BenchmarkTreeparser0(t *testing.B) {
+	t.ReportAllocs()
 	for n := 0; n < t.N; n++ {
 		parseJson([]byte(jsArray[0]))
 	}
 }
 
 func BenchmarkTreeparser1(t *testing.B) {
+	t.ReportAllocs()
 	for n := 0; n < t.N; n++ {
 		parseJson([]byte(jsArray[1]))
 	}
 }
 
 func BenchmarkTreeparser2(t *testing.B) {
+	t.ReportAllocs()
 	for n := 0; n < t.N; n++ {
 		parseJson([]byte(jsArray[2]))
 	}
 }
 
 func BenchmarkTreeparser3(t *testing.B) {
+	t.ReportAllocs()
 	for n := 0; n < t.N; n++ {
 		parseJson([]byte(jsArray[3]))
 	}
 }
+
+func BenchmarkTreeParse(t *testing.B) {
+	t.ReportAllocs()
+	for n := 0; n < t.N; n++ {
+		for _, js := range jsArray {
+			if _, err := qy.NewTree(nil).Parse([]byte(js)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestTreeParse(t *testing.T) {
+	clause, args, err := buildFilter(`{"name": "caf\u00e9 \/ \"x\"", "tags": {"$in": ["a\tb"]}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, `(("name" = ?) AND ("tags" IN (?)))`, clause)
+	assert.Equal(t, []interface{}{`café / "x"`, "a\tb"}, args)
+
+	for _, filter := range []string{
+		`{"name": "a"} {}`,
+		`{"name": }`,
+		`[1, 2]`,
+		`{"name": "a"`,
+	} {
+		_, _, err := buildFilter(filter)
+		assert.Error(t, err, filter)
+	}
+}
+
+func buildFilter(filter string) (string, []interface{}, error) {
+	fm := func(field string) (string, error) {
+		return `"` + field + `"`, nil
+	}
+	tree, err := qy.NewExpressionTree([]byte(filter), fm)
+	if err != nil {
+		return "", nil, err
+	}
+	sb := strings.Builder{}
+	args, err := tree.Build(&sb, qy.NewQmPlaceholder())
+	return sb.String(), args, err
+}
+
+func TestTreeOperators(t *testing.T) {
+	tests := []struct {
+		filter string
+		clause string
+		args   []interface{}
+	}{
+		{`{"name": {"$regex": "^p"}}`, `("name" ~ ?)`, []interface{}{"^p"}},
+		{`{"name": {"$iregex": "^p"}}`, `("name" ~* ?)`, []interface{}{"^p"}},
+		{`{"name": {"$nregex": "^p"}}`, `("name" !~ ?)`, []interface{}{"^p"}},
+		{`{"name": {"$niregex": "^p"}}`, `("name" !~* ?)`, []interface{}{"^p"}},
+		{`{"name": {"$exists": true}}`, `("name" IS NOT NULL)`, nil},
+		{`{"name": {"$exists": false}}`, `("name" IS NULL)`, nil},
+		{`{"name": {"$startsWith": "50%_off"}}`, `("name" LIKE ? ESCAPE '\')`, []interface{}{`50\%\_off%`}},
+		{`{"name": {"$endsWith": "C:\\dir"}}`, `("name" LIKE ? ESCAPE '\')`, []interface{}{`%C:\\dir`}},
+		{`{"name": {"$contains": "kali"}}`, `("name" LIKE ? ESCAPE '\')`, []interface{}{"%kali%"}},
+		{`{"$nor": [{"a": 1}, {"b": {"$gt": 2}}]}`, `(NOT (("a" = ?) OR ("b" > ?)))`, []interface{}{int64(1), int64(2)}},
+		{`{"$nor": [{"a": 1}]}`, `(NOT ("a" = ?))`, []interface{}{int64(1)}},
+		{`{"$or": [{"a": 1}]}`, `(("a" = ?))`, []interface{}{int64(1)}},
+	}
+	for _, test := range tests {
+		clause, args, err := buildFilter(test.filter)
+		assert.NoError(t, err, test.filter)
+		assert.Equal(t, test.clause, clause, test.filter)
+		assert.Equal(t, test.args, args, test.filter)
+	}
+
+	invalids := []string{
+		`{"name": {"$exists": "yes"}}`,
+		`{"name": {"$contains": 10}}`,
+	}
+	for _, filter := range invalids {
+		_, _, err := buildFilter(filter)
+		assert.Error(t, err, filter)
+	}
+}
+
+func TestTreeDeterministic(t *testing.T) {
+	const filter = `{
+		"zeta": 1, "alpha": 2, "mid": {"$gt": 3, "$lt": 9},
+		"$or": [{"b": 4, "a": 5}, {"d": 6, "c": 7}],
+		"omega": null, "beta": "x", "gamma": true
+	}`
+	expected, expectedArgs, err := buildFilter(filter)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, strings.Index(expected, `"zeta"`) < strings.Index(expected, `"alpha"`))
+	assert.True(t, strings.Index(expected, `"b"`) < strings.Index(expected, `"a"`))
+	assert.True(t, strings.Index(expected, `"d"`) < strings.Index(expected, `"c"`))
+
+	for i := 0; i < 100; i++ {
+		clause, args, err := buildFilter(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, clause)
+		assert.Equal(t, expectedArgs, args)
+	}
+}
+
+func TestTreeNumbers(t *testing.T) {
+	tests := []struct {
+		filter string
+		args   []interface{}
+	}{
+		{`{"id": 1234567890123456789}`, []interface{}{int64(1234567890123456789)}},
+		{`{"id": {"$in": [18446744073709551616, -1]}}`, []interface{}{"18446744073709551616", int64(-1)}},
+		{`{"amount": {"$between": [0.5, 1e3]}}`, []interface{}{0.5, 1000.0}},
+	}
+	for _, test := range tests {
+		_, args, err := buildFilter(test.filter)
+		assert.NoError(t, err, test.filter)
+		assert.Equal(t, test.args, args, test.filter)
+	}
+
+	// decimal field stays exact
+	schema := qy.NewFilterSchema().
+		Field("price", qy.FieldSchema{Type: qy.FieldDecimal}).
+		Field("id", qy.FieldSchema{Type: qy.FieldInt})
+	tree, err := qy.NewTree(nil).Schema(schema).
+		Parse([]byte(`{"price": {"$in": [12345678901234567.89, 0.1]}, "id": 9007199254740993}`))
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		args, err := tree.Build(&sb, qy.NewQmPlaceholder())
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"12345678901234567.89", "0.1", int64(9007199254740993)}, args)
+	}
+
+	_, err = qy.NewTree(nil).Schema(schema).Parse([]byte(`{"id": 18446744073709551616}`))
+	assert.Error(t, err)
+}
+
+func TestTreeLimits(t *testing.T) {
+	limits := qy.FilterLimits{
+		MaxDepth:        4,
+		MaxNodes:        20,
+		MaxInLength:     3,
+		MaxStringLength: 8,
+		MaxArgs:         10,
+	}
+	deep := strings.Repeat(`{"$or": [`, 10) + `{"a": 1}` + strings.Repeat(`]}`, 10)
+	many := `{` + strings.Repeat(`"a": null, `, 20) + `"b": null}`
+	args := `{"$or": [` + strings.Repeat(`{"a": {"$between": [1, 2]}}, `, 5) + `{"b": 3}]}`
+
+	tests := map[string]string{
+		deep:                            "MaxDepth",
+		many:                            "MaxNodes",
+		`{"a": {"$in": [1, 2, 3, 4]}}`:  "MaxInLength",
+		`{"a": "123456789"}`:            "MaxStringLength",
+		`{"a": {"$in": ["123456789"]}}`: "MaxStringLength",
+		args:                            "MaxArgs",
+	}
+	for filter, limit := range tests {
+		_, err := qy.NewTree(nil).Limits(limits).Parse([]byte(filter))
+		var limitErr *qy.LimitError
+		if assert.True(t, errors.As(err, &limitErr), filter) {
+			assert.Equal(t, limit, limitErr.Limit, filter)
+		}
+
+		// unlimited by default
+		_, err = qy.NewTree(nil).Parse([]byte(filter))
+		assert.NoError(t, err, filter)
+	}
+
+	_, err := qy.NewTree(nil).Limits(limits).Parse([]byte(`{"$or": [{"a": {"$in": [1, 2]}}, {"b": "short"}]}`))
+	assert.NoError(t, err)
+
+	// value of custom operator is checked while decoding
+	near := func(field string, value interface{}, ph qy.Placeholder) (string, []interface{}, error) {
+		return field + " = " + ph.Next(), []interface{}{value}, nil
+	}
+	for filter, limit := range map[string]string{
+		`{"a": {"$near": [1, 2, 3, 4]}}`:       "MaxInLength",
+		`{"a": {"$near": {"b": "123456789"}}}`: "MaxStringLength",
+		`{"a": {"$near": [[[[1]]]]}}`:          "MaxDepth",
+		`{"a": {"$near": {"x": [1, 2, 3], "y": [1, 2, 3], "z": [1, 2, 3], "w": [1, 2]}}}`: "MaxArgs",
+	} {
+		_, err := qy.NewTree(nil).Limits(limits).RegisterOperator("$near", near).Parse([]byte(filter))
+		var limitErr *qy.LimitError
+		if assert.True(t, errors.As(err, &limitErr), filter) {
+			assert.Equal(t, limit, limitErr.Limit, filter)
+		}
+	}
+
+	// elements of list operators must be scalar, nested array is not counted as single element
+	for _, filter := range []string{`{"a": {"$in": [[1, 2, 3, 4, 5]]}}`, `{"a": {"$nin": [{"b": 1}]}}`,
+		`{"a": {"$between": [1, [2]]}}`, `{"a": {"$in": {"b": 1}}}`} {
+		_, err := qy.NewTree(nil).Limits(limits).Parse([]byte(filter))
+		var fe *qy.FilterError
+		if assert.True(t, errors.As(err, &fe), filter) {
+			assert.Equal(t, qy.ErrCodeInvalidValue, fe.Code, filter)
+			assert.Equal(t, "$.a."+fe.Term, fe.Path, filter)
+		}
+	}
+
+	// limits are opt-in, NewExpressionTree does not limit the filter
+	in := `{"a": {"$in": [` + strings.Repeat(`1, `, qy.DefaultFilterLimits.MaxInLength) + `1]}}`
+	_, err = qy.NewExpressionTree([]byte(in), nil)
+	assert.NoError(t, err)
+	_, err = qy.NewTree(nil).Limits(qy.DefaultFilterLimits).Parse([]byte(in))
+	var limitErr *qy.LimitError
+	if assert.True(t, errors.As(err, &limitErr)) {
+		assert.Equal(t, "MaxInLength", limitErr.Limit)
+	}
+}
+
+func TestTreeFieldOperators(t *testing.T) {
+	tests := []struct {
+		filter string
+		clause string
+		args   []interface{}
+	}{
+		{`{"age": {"$gt": 18, "$lt": 65}}`, `(("age" > ?) AND ("age" < ?))`, []interface{}{int64(18), int64(65)}},
+		{`{"age": {"$or": [{"$lt": 18}, {"$gt": 65}]}}`, `(("age" < ?) OR ("age" > ?))`, []interface{}{int64(18), int64(65)}},
+		{`{"age": [{"$lt": 18}, {"$gt": 65}]}`, `(("age" < ?) OR ("age" > ?))`, []interface{}{int64(18), int64(65)}},
+		{`{"age": {"$not": {"$gt": 5}}}`, `(NOT ("age" > ?))`, []interface{}{int64(5)}},
+		{`{"age": {"$not": {"$gt": 5, "$lt": 1}}}`, `(NOT (("age" > ?) AND ("age" < ?)))`, []interface{}{int64(5), int64(1)}},
+		{`{"age": {"$gte": 1, "$nor": [{"$eq": 3}, {"$in": [5, 7]}]}}`,
+			`(("age" >= ?) AND (NOT (("age" = ?) OR ("age" IN (?,?)))))`,
+			[]interface{}{int64(1), int64(3), int64(5), int64(7)}},
+		{`{"name": "a", "age": {"$and": [{"$gt": 1}, {"$lt": 9}]}}`,
+			`(("name" = ?) AND (("age" > ?) AND ("age" < ?)))`,
+			[]interface{}{"a", int64(1), int64(9)}},
+	}
+	for _, test := range tests {
+		clause, args, err := buildFilter(test.filter)
+		assert.NoError(t, err, test.filter)
+		assert.Equal(t, test.clause, clause, test.filter)
+		assert.Equal(t, test.args, args, test.filter)
+	}
+
+	invalids := []string{
+		`{"$gt": 5}`,
+		`{"age": {"name": 5}}`,
+		`{"age": {"$gt": {"$lt": 5}}}`,
+		`{"age": {"$unknown": 5}}`,
+	}
+	for _, filter := range invalids {
+		_, _, err := buildFilter(filter)
+		assert.Error(t, err, filter)
+	}
+
+	// logical operator needs object or array value
+	for _, filter := range []string{`{"age": {"$not": 5}}`, `{"$or": "a"}`, `{"age": {"$and": null}}`} {
+		_, err := qy.NewTree(nil).Parse([]byte(filter))
+		var fe *qy.FilterError
+		if assert.True(t, errors.As(err, &fe), filter) {
+			assert.Equal(t, qy.ErrCodeInvalidValue, fe.Code, filter)
+		}
+	}
+}
+
+func TestTreeNull(t *testing.T) {
+	tests := []struct {
+		filter string
+		clause string
+		args   []interface{}
+	}{
+		{`{"f": null}`, `("f" IS NULL)`, nil},
+		{`{"f": {"$eq": null}}`, `("f" IS NULL)`, nil},
+		{`{"f": {"$neq": null}}`, `("f" IS NOT NULL)`, nil},
+		{`{"f": {"$in": [1, null]}}`, `("f" IN (?) OR "f" IS NULL)`, []interface{}{int64(1)}},
+		{`{"f": {"$in": [null]}}`, `("f" IS NULL)`, nil},
+		{`{"f": {"$nin": [1, 2, null]}}`, `("f" NOT IN (?,?) AND "f" IS NOT NULL)`, []interface{}{int64(1), int64(2)}},
+		{`{"f": {"$in": []}}`, `(1=0)`, nil},
+		{`{"f": {"$nin": []}}`, `(1=1)`, nil},
+		{`{"f": {"$isDistinctFrom": 1}}`, `("f" IS DISTINCT FROM ?)`, []interface{}{int64(1)}},
+		{`{"f": {"$isNotDistinctFrom": null}}`, `("f" IS NOT DISTINCT FROM NULL)`, nil},
+	}
+	for _, test := range tests {
+		clause, args, err := buildFilter(test.filter)
+		assert.NoError(t, err, test.filter)
+		assert.Equal(t, test.clause, clause, test.filter)
+		assert.Equal(t, test.args, args, test.filter)
+	}
+
+	tree, err := qy.NewTree(nil).Dialect(qy.MySQL).Parse([]byte(`{"f": {"$isDistinctFrom": 1}}`))
+	if assert.NoError(t, err) {
+		sb := strings.Builder{}
+		_, err = tree.Build(&sb, qy.NewQmPlaceholder())
+		assert.NoError(t, err)
+		assert.Equal(t, `(NOT (f <=> ?))`, sb.String())
+	}
+}
+
+func TestTreeLikeEscape(t *testing.T) {
+	tests := []struct {
+		dialect qy.Dialect
+		clause  string
+	}{
+		{qy.Postgres, `(("name" LIKE $1 ESCAPE '\') AND ("code" ILIKE $2 ESCAPE '\'))`},
+		{qy.MySQL, `(("name" LIKE ? ESCAPE '\\') AND ("code" ILIKE ? ESCAPE '\\'))`},
+		{qy.SQLite, `(("name" LIKE ? ESCAPE '\') AND ("code" ILIKE ? ESCAPE '\'))`},
+	}
+	fm := func(field string) (string, error) {
+		return `"` + field + `"`, nil
+	}
+	for _, test := range tests {
+		tree, err := qy.NewTree(fm).Dialect(test.dialect).
+			Parse([]byte(`{"name": {"$contains": "50%"}, "code": {"$ilike": "a\\_%"}}`))
+		if !assert.NoError(t, err, test.dialect.Name()) {
+			continue
+		}
+		sb := strings.Builder{}
+		args, err := tree.Build(&sb, test.dialect.Placeholder())
+		assert.NoError(t, err, test.dialect.Name())
+		assert.Equal(t, test.clause, sb.String(), test.dialect.Name())
+		assert.Equal(t, []interface{}{`%50\%%`, `a\_%`}, args, test.dialect.Name())
+	}
+}
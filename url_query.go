@@ -0,0 +1,200 @@
+package squery
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Reserved keys of URL query
+const (
+	URLSortKey    = "sort"    // e.g. sort=-created_at,name
+	URLPageKey    = "page"    // page number, starts from 1
+	URLPerPageKey = "perPage" // number of record in one page
+	URLFieldsKey  = "fields"  // e.g. fields=id,name
+)
+
+var reJSONNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// ParseURLQuery converts URL query in bracket-operator form, e.g.
+//
+//	status=A&qty[lt]=30&tags[in]=a,b&sort=-created_at&page=2&perPage=50
+//
+// into ListSearchArg. Filter is JSON filter using the same operators as the JSON DSL,
+// i.e. field[op]=value is {"field": {"$op": value}}, field=value is {"field": value} and
+// repeated field=a&field=b is {"field": {"$in": [a, b]}}.
+// Values of in, nin and between are separated by comma. Value is decoded as number,
+// boolean or null if possible, otherwise as string. Value of text operator, e.g. contains or like,
+// is always string. Schema converts the value back into text for text and enum fields.
+// Fields are written in sorted order. Key starting with underscore, e.g. cache buster _=123, is ignored.
+// Every other key is filter field, use Schema of the tree to reject unknown fields.
+func ParseURLQuery(values url.Values) (*ListSearchArg, error) {
+	arg := &ListSearchArg{}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	filter := filterObject{}
+	fieldIdx := make(map[string]int)
+	for _, key := range keys {
+		vals := values[key]
+		switch key {
+		case URLSortKey:
+			arg.Sorts = append(arg.Sorts, urlSorts(vals)...)
+			continue
+		case URLPageKey, URLPerPageKey:
+			n, err := strconv.ParseInt(lastValue(vals), 10, 64)
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid " + key + " value in URL query")
+			}
+			if arg.Pagination == nil {
+				arg.Pagination = &Pagination{}
+			}
+			if key == URLPageKey {
+				arg.Pagination.Page = n
+			} else {
+				arg.Pagination.PerPage = n
+			}
+			continue
+		case URLFieldsKey:
+			arg.Fields = append(arg.Fields, splitValues(vals)...)
+			continue
+		}
+
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+
+		field, op, err := splitURLKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if op == opEq && len(vals) > 1 {
+			// field=a&field=b is field IN (a, b)
+			op = opIn
+		}
+		value, err := urlFilterValue(op, vals)
+		if err != nil {
+			return nil, errors.New(key + ": " + err.Error())
+		}
+
+		idx, ok := fieldIdx[field]
+		if !ok {
+			idx = len(filter)
+			fieldIdx[field] = idx
+			filter = append(filter, filterEntry{key: field, value: filterObject{}})
+		}
+		ops := filter[idx].value.(filterObject)
+		filter[idx].value = append(ops, filterEntry{key: op, value: value})
+	}
+
+	// simplify {"field": {"$eq": value}} into {"field": value}
+	for i, entry := range filter {
+		if ops := entry.value.(filterObject); len(ops) == 1 && ops[0].key == opEq {
+			filter[i].value = ops[0].value
+		}
+	}
+	if len(filter) > 0 {
+		data, err := json.Marshal(filter)
+		if err != nil {
+			return nil, err
+		}
+		arg.Filter = data
+	}
+	return arg, nil
+}
+
+// splitURLKey splits field[op] into field and $op, op is $eq if not specified
+func splitURLKey(key string) (string, string, error) {
+	idx := strings.IndexByte(key, '[')
+	if idx < 0 {
+		return key, opEq, nil
+	}
+	if idx == 0 || !strings.HasSuffix(key, "]") {
+		return "", "", errors.New("invalid URL query key " + key)
+	}
+	op := "$" + key[idx+1:len(key)-1]
+	if _, ok := opToSQL[op]; !ok || op == opAnd || op == opOr || op == opNot || op == opNor {
+		return "", "", errors.New("unknown operator " + op + " in URL query key " + key)
+	}
+	return key[:idx], op, nil
+}
+
+// urlFilterValue converts query values of the operator into filter value
+func urlFilterValue(op string, vals []string) (interface{}, error) {
+	if containsString(textOperators, op) {
+		return lastValue(vals), nil
+	}
+	switch op {
+	case opIn, opNotIn, opBetween:
+		items := splitValues(vals)
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			list[i] = urlScalar(item)
+		}
+		if op == opBetween && len(list) != 2 {
+			return nil, errors.New("$between operator needs 2 values")
+		}
+		return list, nil
+	}
+	return urlScalar(lastValue(vals)), nil
+}
+
+// urlScalar decodes number, boolean and null, other value is kept as string
+func urlScalar(str string) interface{} {
+	switch str {
+	case "null":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if reJSONNumber.MatchString(str) {
+		return json.Number(str)
+	}
+	return str
+}
+
+// urlSorts converts sort values, e.g. -created_at,name, into sort conditions
+func urlSorts(vals []string) SortConditions {
+	sorts := SortConditions{}
+	for _, field := range splitValues(vals) {
+		order := AscendingOrder
+		if strings.HasPrefix(field, "-") {
+			field, order = field[1:], DescendingOrder
+		} else if strings.HasPrefix(field, "+") {
+			field = field[1:]
+		}
+		if field != "" {
+			sorts = append(sorts, &Sort{Fields: []string{field}, Order: order})
+		}
+	}
+	return sorts
+}
+
+// splitValues splits comma separated values
+func splitValues(vals []string) []string {
+	items := []string{}
+	for _, val := range vals {
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+func lastValue(vals []string) string {
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[len(vals)-1]
+}
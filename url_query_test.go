@@ -0,0 +1,61 @@
+package squery_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	qy "github.com/ipsusila/squery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseURLQuery(t *testing.T) {
+	values, err := url.ParseQuery("status=A&qty[lt]=30&qty[gte]=1.5&tags[in]=a,b&name[like]=foo%25" +
+		"&deleted=null&id=1&id=2&sort=-created_at,name&page=2&perPage=50&fields=id,name")
+	if !assert.NoError(t, err) {
+		return
+	}
+	arg, err := qy.ParseURLQuery(values)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `{"deleted":null,"id":{"$in":[1,2]},"name":{"$like":"foo%"},`+
+		`"qty":{"$gte":1.5,"$lt":30},"status":"A","tags":{"$in":["a","b"]}}`, string(arg.Filter))
+	assert.Equal(t, qy.SortConditions{
+		{Fields: []string{"created_at"}, Order: qy.DescendingOrder},
+		{Fields: []string{"name"}, Order: qy.AscendingOrder},
+	}, arg.Sorts)
+	assert.Equal(t, &qy.Pagination{Page: 2, PerPage: 50}, arg.Pagination)
+	assert.Equal(t, []string{"id", "name"}, arg.Fields)
+
+	clause, args, err := buildFilter(string(arg.Filter))
+	assert.NoError(t, err)
+	assert.Equal(t, `(("deleted" IS NULL) AND ("id" IN (?,?)) AND ("name" LIKE ? ESCAPE '\') AND `+
+		`(("qty" >= ?) AND ("qty" < ?)) AND ("status" = ?) AND ("tags" IN (?,?)))`, clause)
+	assert.Equal(t, []interface{}{int64(1), int64(2), "foo%", 1.5, int64(30), "A", "a", "b"}, args)
+
+	// cache buster is ignored, values are converted back into text by schema
+	values, _ = url.ParseQuery("_=1618&name=123&code[in]=007,true&status=true&note[contains]=10")
+	arg, err = qy.ParseURLQuery(values)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `{"code":{"$in":["007",true]},"name":123,"note":{"$contains":"10"},"status":true}`, string(arg.Filter))
+		schema := qy.NewFilterSchema().
+			Field("name", qy.FieldSchema{Type: qy.FieldText}).
+			Field("code", qy.FieldSchema{Type: qy.FieldText}).
+			Field("note", qy.FieldSchema{Type: qy.FieldText}).
+			Field("status", qy.FieldSchema{Type: qy.FieldEnum, Values: []string{"true", "false"}})
+		tree, err := qy.NewTree(nil).Schema(schema).Parse(arg.Filter)
+		if assert.NoError(t, err) {
+			sb := strings.Builder{}
+			args, err := tree.Build(&sb, qy.NewQmPlaceholder())
+			assert.NoError(t, err)
+			assert.Equal(t, []interface{}{"007", "true", "123", "%10%", "true"}, args)
+		}
+	}
+
+	for _, query := range []string{"age[unknown]=1", "age[or]=1", "age[between]=1", "page=x", "[gt]=1", "age[gt=1"} {
+		values, _ := url.ParseQuery(query)
+		_, err := qy.ParseURLQuery(values)
+		assert.Error(t, err, query)
+	}
+}